@@ -4,10 +4,9 @@ package wxdev
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"net/http"
 	"net/url"
 )
 
@@ -18,8 +17,16 @@ const (
 
 // CreateQRCode 创建二维码
 func (c *WXClient) CreateQRCode(sceneValue interface{}, seconds int) (io.Reader, error) {
+	return c.CreateQRCodeContext(context.Background(), sceneValue, seconds)
+}
+
+// CreateQRCodeContext 创建二维码
+func (c *WXClient) CreateQRCodeContext(ctx context.Context, sceneValue interface{}, seconds int) (io.Reader, error) {
 	const uri = "https://api.weixin.qq.com/cgi-bin/qrcode/create?access_token=%s"
-	token, _ := c.getAccessToken()
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
 	data := make(map[string]interface{})
 	isNumber := func() bool {
 		switch sceneValue.(type) {
@@ -57,28 +64,23 @@ func (c *WXClient) CreateQRCode(sceneValue interface{}, seconds int) (io.Reader,
 		}
 	}
 	var result struct {
-		Ticket string `json:"ticket"`
-		URL    string `json:"url"`
-		Expire int    `json:"expire_seconds"`
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+		Ticket  string `json:"ticket"`
+		URL     string `json:"url"`
+		Expire  int    `json:"expire_seconds"`
 	}
-	err := c.httpPost(fmt.Sprintf(uri, token), data, &result)
+	err = c.httpPost(ctx, fmt.Sprintf(uri, token), data, &result)
 	if err != nil {
 		return nil, err
 	}
-	const qrcode_uri = "https://mp.weixin.qq.com/cgi-bin/showqrcode?ticket=%s"
-	req, _ := http.NewRequest("GET", fmt.Sprintf(qrcode_uri, url.QueryEscape(result.Ticket)), nil)
-	resp, err := c.httpDo(req)
-	if resp != nil {
-		defer resp.Body.Close()
+	if result.ErrCode != 0 {
+		return nil, NewAPIError(result.ErrCode, result.ErrMsg)
 	}
+	const qrcode_uri = "https://mp.weixin.qq.com/cgi-bin/showqrcode?ticket=%s"
+	resp, err := c.api.Download(ctx, "GET", fmt.Sprintf(qrcode_uri, url.QueryEscape(result.Ticket)), nil, "")
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode != http.StatusOK {
-		errmsg, _ := ioutil.ReadAll(resp.Body)
-		return nil, fmt.Errorf("%s", string(errmsg))
-	}
-	var buf bytes.Buffer
-	_, err = io.Copy(&buf, resp.Body)
-	return &buf, err
+	return bytes.NewReader(resp.Body), nil
 }
@@ -0,0 +1,149 @@
+// 异步消息处理
+
+package wxdev
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// WithAsyncHandler 启用异步消息处理, 收到消息后立即回复success,
+// 由 workers 个协程执行消息处理器, 处理结果通过客服消息接口下发.
+// 待处理队列长度为 queueSize, 队列已满时退化为同步处理.
+// 协程在收到第一条消息时启动, 退出前需调用 Close 等待队列中的消息处理完毕
+func WithAsyncHandler(workers, queueSize int) OptionFunc {
+	return func(c *WXClient) {
+		if workers <= 0 {
+			workers = 1
+		}
+		if queueSize < 0 {
+			queueSize = 0
+		}
+		c.async = &asyncPool{workers: workers, queue: make(chan WXMessageRequest, queueSize)}
+	}
+}
+
+// asyncPool 异步消息处理的队列及协程
+type asyncPool struct {
+	workers int
+	queue   chan WXMessageRequest
+	once    sync.Once
+	mu      sync.RWMutex
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// Close 停止异步消息处理并等待队列中的消息处理完毕, 此后收到的消息将同步处理
+func (c *WXClient) Close() error {
+	p := c.async
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+	return nil
+}
+
+// dispatchAsync 将消息放入异步队列, 队列已满或已关闭时返回false
+func (c *WXClient) dispatchAsync(req WXMessageRequest) bool {
+	p := c.async
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+	p.once.Do(func() {
+		p.wg.Add(p.workers)
+		for i := 0; i < p.workers; i++ {
+			go c.asyncWorker()
+		}
+	})
+	select {
+	case p.queue <- req:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *WXClient) asyncWorker() {
+	defer c.async.wg.Done()
+	for req := range c.async.queue {
+		c.handleAsync(req)
+	}
+}
+
+func (c *WXClient) handleAsync(req WXMessageRequest) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("WXDev: async handle message panic, error:%v\n%s", err, debug.Stack())
+		}
+	}()
+	resp := c.msgHandler(req)
+	if _, ok := resp.(WXMessageOKResponse); ok || resp == nil {
+		return
+	}
+	reply, err := CSMsgFromResponse(resp, req.FromUserName)
+	if err != nil {
+		log.Println("WXDev: convert async reply failed,error:", err)
+		return
+	}
+	if err = c.SendCSMsg(reply); err != nil {
+		log.Printf("WXDev: send async reply to %s failed,error:%v", req.FromUserName, err)
+	}
+}
+
+// CSMsgFromResponse 将被动回复消息转换为客服消息, to 为空时使用回复消息的 ToUserName.
+// 转发客服系统的回复无法转换为客服消息
+func CSMsgFromResponse(resp WXMessageResponse, to string) (CSMsgReply, error) {
+	touser := func(r WXMsgResponse) CSMsgReply {
+		if to == "" {
+			to = r.ToUserName
+		}
+		return NewCSMsgReply(to)
+	}
+	switch msg := resp.(type) {
+	case WXTextMsgResponse:
+		return touser(msg.WXMsgResponse).WithText(msg.Content.Text), nil
+	case WXImgMsgResponse:
+		return touser(msg.WXMsgResponse).WithImage(msg.MediaID.Text), nil
+	case WXVoiceMsgResponse:
+		return touser(msg.WXMsgResponse).WithVoice(msg.MediaID.Text), nil
+	case WXVideoMsgResponse:
+		return touser(msg.WXMsgResponse).WithVideo(msg.MediaID.Text, "", msg.Title.Text, msg.Description.Text), nil
+	case WXMusicMsgResponse:
+		music := msg.Music
+		return touser(msg.WXMsgResponse).WithMusic(music.Title.Text, music.Description.Text, music.MusicURL.Text, music.HQMusicUrl.Text, music.ThumbMediaId.Text), nil
+	case WXArticleMsgResponse:
+		articles := make([]CSNewsArticle, 0, len(msg.Articles))
+		for _, item := range msg.Articles {
+			articles = append(articles, CSNewsArticle{
+				Title:       item.Title.Text,
+				Description: item.Description.Text,
+				URL:         item.Url.Text,
+				PicURL:      item.PicUrl.Text,
+			})
+		}
+		return touser(msg.WXMsgResponse).WithNews(articles...), nil
+	case *WXTextMsgResponse:
+		return CSMsgFromResponse(*msg, to)
+	case *WXImgMsgResponse:
+		return CSMsgFromResponse(*msg, to)
+	case *WXVoiceMsgResponse:
+		return CSMsgFromResponse(*msg, to)
+	case *WXVideoMsgResponse:
+		return CSMsgFromResponse(*msg, to)
+	case *WXMusicMsgResponse:
+		return CSMsgFromResponse(*msg, to)
+	case *WXArticleMsgResponse:
+		return CSMsgFromResponse(*msg, to)
+	}
+	return CSMsgReply{}, fmt.Errorf("WXDev: unsupported reply type %T", resp)
+}
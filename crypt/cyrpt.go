@@ -25,11 +25,16 @@ func MD5(plainText []byte) string {
 
 // AESEncrypt AES加密
 func AESEncrypt(plaintext, key, iv []byte) ([]byte, error) {
+	return AESEncryptWithBlockSize(plaintext, key, iv, aes.BlockSize)
+}
+
+// AESEncryptWithBlockSize AES加密, 按指定块大小进行PKCS#7填充
+func AESEncryptWithBlockSize(plaintext, key, iv []byte, blockSize int) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
-	plaintext = pkcsPadding(plaintext, block.BlockSize())
+	plaintext = pkcsPadding(plaintext, blockSize)
 	mode := cipher.NewCBCEncrypter(block, iv)
 	crypted := make([]byte, len(plaintext))
 	mode.CryptBlocks(crypted, plaintext)
@@ -57,6 +62,9 @@ func pkcsPadding(ciphertext []byte, blockSize int) []byte {
 
 func pkcsUnPadding(origData []byte) []byte {
 	length := len(origData)
+	if length == 0 {
+		return nil
+	}
 	unpadding := int(origData[length-1])
 	if unpadding > length {
 		return nil
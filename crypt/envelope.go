@@ -0,0 +1,117 @@
+// 消息推送的签名校验及安全模式封装, 公众号与小程序共用
+
+package crypt
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidSignature 推送请求的signature校验失败
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrEncryptRequired 安全模式下收到明文推送
+	ErrEncryptRequired = errors.New("encrypted message required")
+)
+
+// EncryptedMsg 安全模式下的推送及回复消息, 支持XML及JSON格式
+type EncryptedMsg struct {
+	XMLName      xml.Name `xml:"xml" json:"-"`
+	ToUserName   string   `xml:",omitempty" json:",omitempty"`
+	Encrypt      string
+	MsgSignature string `xml:",omitempty" json:",omitempty"`
+	TimeStamp    int64  `xml:",omitempty" json:",omitempty"`
+	Nonce        string `xml:",omitempty" json:",omitempty"`
+}
+
+// MsgEnvelope 消息推送的签名校验及加解密, AESKey 为空时为明文模式
+type MsgEnvelope struct {
+	Token  string // 服务器配置中的令牌(Token)
+	AppID  string
+	AESKey []byte // EncodingAESKey 解码后的密钥
+}
+
+// Encrypted 是否为安全模式
+func (e MsgEnvelope) Encrypted() bool { return len(e.AESKey) > 0 }
+
+// Signature 计算URL验证及推送请求的签名 signature
+func (e MsgEnvelope) Signature(timestamp, nonce string) string {
+	params := []string{e.Token, timestamp, nonce}
+	sort.Strings(params)
+	return SHA1([]byte(strings.Join(params, "")))
+}
+
+// VerifySignature 校验请求参数中的signature
+func (e MsgEnvelope) VerifySignature(query url.Values) bool {
+	return e.Signature(query.Get("timestamp"), query.Get("nonce")) == query.Get("signature")
+}
+
+// Open 校验推送请求并返回消息明文, 签名错误时返回 ErrInvalidSignature,
+// 安全模式下收到明文推送时返回 ErrEncryptRequired
+func (e MsgEnvelope) Open(query url.Values, body []byte) ([]byte, error) {
+	if !e.VerifySignature(query) {
+		return nil, ErrInvalidSignature
+	}
+	if !e.Encrypted() {
+		return body, nil
+	}
+	// 配置了EncodingAESKey时只接受密文消息, 避免伪造的明文消息绕过msg_signature校验
+	if query.Get("encrypt_type") != "aes" || query.Get("msg_signature") == "" {
+		return nil, ErrEncryptRequired
+	}
+	var req EncryptedMsg
+	var err error
+	if isJSON(body) {
+		err = json.Unmarshal(body, &req)
+	} else {
+		err = xml.Unmarshal(body, &req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req.Encrypt == "" {
+		return nil, fmt.Errorf("Encrypt field is missing")
+	}
+	if MsgSignature(e.Token, query.Get("timestamp"), query.Get("nonce"), req.Encrypt) != query.Get("msg_signature") {
+		return nil, fmt.Errorf("msg_signature mismatch")
+	}
+	msg, appid, err := DecryptMsg(e.AESKey, req.Encrypt)
+	if err != nil {
+		return nil, err
+	}
+	if appid != e.AppID {
+		return nil, fmt.Errorf("appid mismatch, expect:%s, actual:%s", e.AppID, appid)
+	}
+	return msg, nil
+}
+
+// Seal 加密回复消息明文, 生成带msg_signature的密文消息
+func (e MsgEnvelope) Seal(plain []byte) (EncryptedMsg, error) {
+	encrypt, err := EncryptMsg(e.AESKey, e.AppID, plain)
+	if err != nil {
+		return EncryptedMsg{}, err
+	}
+	timestamp := time.Now().Unix()
+	b := make([]byte, 8)
+	rand.Read(b)
+	nonce := hex.EncodeToString(b)
+	return EncryptedMsg{
+		Encrypt:      encrypt,
+		MsgSignature: MsgSignature(e.Token, strconv.FormatInt(timestamp, 10), nonce, encrypt),
+		TimeStamp:    timestamp,
+		Nonce:        nonce,
+	}, nil
+}
+
+func isJSON(data []byte) bool {
+	return strings.HasPrefix(strings.TrimSpace(string(data)), "{")
+}
@@ -0,0 +1,82 @@
+// 微信消息加解密(安全模式)
+
+package crypt
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// MsgBlockSize 微信消息加解密使用的PKCS#7填充块大小
+const MsgBlockSize = 32
+
+// ErrInvalidMsg 密文格式错误
+var ErrInvalidMsg = errors.New("invalid encrypted message")
+
+// DecodeAESKey 解析EncodingAESKey(43位base64字符串)
+func DecodeAESKey(encodingAESKey string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, errors.New("invalid EncodingAESKey")
+	}
+	return key, nil
+}
+
+// MsgSignature 计算安全模式下的消息签名 msg_signature
+func MsgSignature(token, timestamp, nonce, encrypt string) string {
+	params := []string{token, timestamp, nonce, encrypt}
+	sort.Strings(params)
+	return SHA1([]byte(strings.Join(params, "")))
+}
+
+// EncryptMsg 加密消息, 明文格式为 random(16B) + msg_len(4B) + msg + appid
+func EncryptMsg(key []byte, appid string, msg []byte) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return encryptMsg(key, random, appid, msg)
+}
+
+func encryptMsg(key, random []byte, appid string, msg []byte) (string, error) {
+	plaintext := make([]byte, 20, 20+len(msg)+len(appid))
+	copy(plaintext, random)
+	binary.BigEndian.PutUint32(plaintext[16:20], uint32(len(msg)))
+	plaintext = append(plaintext, msg...)
+	plaintext = append(plaintext, appid...)
+	crypted, err := AESEncryptWithBlockSize(plaintext, key, key[:16], MsgBlockSize)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(crypted), nil
+}
+
+// DecryptMsg 解密消息, 返回消息明文及其所属appid
+func DecryptMsg(key []byte, encrypted string) ([]byte, string, error) {
+	crypted, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(crypted) == 0 || len(crypted)%16 != 0 {
+		return nil, "", ErrInvalidMsg
+	}
+	plaintext, err := AESDecrypt(crypted, key, key[:16])
+	if err != nil {
+		return nil, "", err
+	}
+	if len(plaintext) < 20 {
+		return nil, "", ErrInvalidMsg
+	}
+	msgLen := int(binary.BigEndian.Uint32(plaintext[16:20]))
+	if msgLen < 0 || 20+msgLen > len(plaintext) {
+		return nil, "", ErrInvalidMsg
+	}
+	return plaintext[20 : 20+msgLen], string(plaintext[20+msgLen:]), nil
+}
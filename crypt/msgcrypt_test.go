@@ -0,0 +1,80 @@
+package crypt
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+// 腾讯官方WXBizMsgCrypt示例中的回调URL验证数据
+const (
+	sampleToken          = "QDG6eK"
+	sampleEncodingAESKey = "jWmYm7qr5nMoAUwZRjGtBxmz3KA1tkAj3ykkR6q2B2C"
+	sampleReceiveID      = "wx5823bf96d3bd56c7"
+	sampleTimestamp      = "1409659589"
+	sampleNonce          = "263014780"
+	sampleMsgSignature   = "5c45ff5e21c57e6ad56bac8758b79b1d9ac89fd3"
+	sampleEncrypt        = "P9nAzCzyDtyTWESHep1vC5X9xho/qYX3Zpb4yKa9SKld1DsH3Iyt3tP3zNdtp+4RPcs8TgAE7OaBO+FZXvnaqQ=="
+	samplePlaintext      = "1616140317555161061"
+)
+
+func TestMsgSignatureOfficialSample(t *testing.T) {
+	if sign := MsgSignature(sampleToken, sampleTimestamp, sampleNonce, sampleEncrypt); sign != sampleMsgSignature {
+		t.Fatalf("msg_signature = %s, want %s", sign, sampleMsgSignature)
+	}
+}
+
+func TestDecryptMsgOfficialSample(t *testing.T) {
+	key, err := DecodeAESKey(sampleEncodingAESKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, appid, err := DecryptMsg(key, sampleEncrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != samplePlaintext {
+		t.Errorf("msg = %q, want %q", msg, samplePlaintext)
+	}
+	if appid != sampleReceiveID {
+		t.Errorf("appid = %q, want %q", appid, sampleReceiveID)
+	}
+}
+
+func TestEncryptMsgOfficialSample(t *testing.T) {
+	key, err := DecodeAESKey(sampleEncodingAESKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 使用示例密文中的16字节随机串重新加密, 结果应与官方密文完全一致
+	crypted, _ := base64.StdEncoding.DecodeString(sampleEncrypt)
+	plaintext, err := AESDecrypt(crypted, key, key[:16])
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypt, err := encryptMsg(key, plaintext[:16], sampleReceiveID, []byte(samplePlaintext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encrypt != sampleEncrypt {
+		t.Fatalf("encrypt = %s, want %s", encrypt, sampleEncrypt)
+	}
+}
+
+func TestDecryptMsgInvalid(t *testing.T) {
+	key, _ := DecodeAESKey(sampleEncodingAESKey)
+	for _, encrypted := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, _, err := DecryptMsg(key, encrypted); err == nil {
+			t.Errorf("DecryptMsg(%q) succeeded, want error", encrypted)
+		}
+	}
+}
+
+func TestDecodeAESKey(t *testing.T) {
+	if _, err := DecodeAESKey(sampleEncodingAESKey[:42]); err == nil {
+		t.Error("DecodeAESKey accepted a 42 character key")
+	}
+	key, err := DecodeAESKey(sampleEncodingAESKey)
+	if err != nil || len(key) != 32 {
+		t.Fatalf("DecodeAESKey = %d bytes, %v", len(key), err)
+	}
+}
@@ -3,6 +3,7 @@
 package wxdev
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -24,31 +25,34 @@ func (reply CSMsgReply) data() interface{} {
 }
 
 // WithText 文本消息
-func (reply CSMsgReply) WithText(content string) {
+func (reply CSMsgReply) WithText(content string) CSMsgReply {
 	reply.fields["msgtype"] = "text"
 	reply.fields["text"] = struct {
 		Content string `json:"content"`
 	}{content}
+	return reply
 }
 
 // WithImage 图片消息
-func (reply CSMsgReply) WithImage(mediaid string) {
+func (reply CSMsgReply) WithImage(mediaid string) CSMsgReply {
 	reply.fields["msgtype"] = "image"
 	reply.fields["image"] = struct {
 		MediaID string `json:"media_id"`
 	}{mediaid}
+	return reply
 }
 
 // WithVoice 语音消息
-func (reply CSMsgReply) WithVoice(mediaid string) {
+func (reply CSMsgReply) WithVoice(mediaid string) CSMsgReply {
 	reply.fields["msgtype"] = "voice"
 	reply.fields["voice"] = struct {
 		MediaID string `json:"media_id"`
 	}{mediaid}
+	return reply
 }
 
 // WithVideo 视频消息
-func (reply CSMsgReply) WithVideo(mediaid, thumbMediaid, title, desc string) {
+func (reply CSMsgReply) WithVideo(mediaid, thumbMediaid, title, desc string) CSMsgReply {
 	reply.fields["msgtype"] = "video"
 	reply.fields["video"] = struct {
 		MediaID string `json:"media_id"`
@@ -56,22 +60,116 @@ func (reply CSMsgReply) WithVideo(mediaid, thumbMediaid, title, desc string) {
 		Title   string `json:"title"`
 		Desc    string `json:"description"`
 	}{mediaid, thumbMediaid, title, desc}
+	return reply
+}
+
+// WithMusic 音乐消息
+func (reply CSMsgReply) WithMusic(title, desc, musicURL, hqMusicURL, thumbMediaid string) CSMsgReply {
+	reply.fields["msgtype"] = "music"
+	reply.fields["music"] = struct {
+		Title      string `json:"title"`
+		Desc       string `json:"description"`
+		MusicURL   string `json:"musicurl"`
+		HQMusicURL string `json:"hqmusicurl"`
+		Thumb      string `json:"thumb_media_id"`
+	}{title, desc, musicURL, hqMusicURL, thumbMediaid}
+	return reply
+}
+
+// CSNewsArticle 客服图文消息(点击跳转到外链)
+type CSNewsArticle struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	PicURL      string `json:"picurl"`
+}
+
+// WithNews 图文消息(点击跳转到外链), 图文消息条数限制在1条以内
+func (reply CSMsgReply) WithNews(articles ...CSNewsArticle) CSMsgReply {
+	reply.fields["msgtype"] = "news"
+	reply.fields["news"] = struct {
+		Articles []CSNewsArticle `json:"articles"`
+	}{articles}
+	return reply
+}
+
+// WithMpNewsArticle 图文消息(点击跳转到图文消息页面), articleID 为发布文章的article_id
+func (reply CSMsgReply) WithMpNewsArticle(articleID string) CSMsgReply {
+	reply.fields["msgtype"] = "mpnewsarticle"
+	reply.fields["mpnewsarticle"] = struct {
+		ArticleID string `json:"article_id"`
+	}{articleID}
+	return reply
+}
+
+// CSMenuOption 菜单消息选项, 用户点击后会推送 Content 为选项内容、bizmsgmenuid 为 ID 的文本消息
+type CSMenuOption struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+}
+
+// WithMenu 菜单消息
+func (reply CSMsgReply) WithMenu(head, tail string, options ...CSMenuOption) CSMsgReply {
+	reply.fields["msgtype"] = "msgmenu"
+	reply.fields["msgmenu"] = struct {
+		Head    string         `json:"head_content"`
+		Options []CSMenuOption `json:"list"`
+		Tail    string         `json:"tail_content"`
+	}{head, options, tail}
+	return reply
+}
+
+// WithWxCard 卡券消息, 仅支持非自定义Code码和导入code模式的卡券
+func (reply CSMsgReply) WithWxCard(cardID string) CSMsgReply {
+	reply.fields["msgtype"] = "wxcard"
+	reply.fields["wxcard"] = struct {
+		CardID string `json:"card_id"`
+	}{cardID}
+	return reply
+}
+
+// WithMiniProgramPage 小程序卡片消息, 小程序需与公众号关联
+func (reply CSMsgReply) WithMiniProgramPage(appid, title, pagepath, thumbMediaid string) CSMsgReply {
+	reply.fields["msgtype"] = "miniprogrampage"
+	reply.fields["miniprogrampage"] = struct {
+		Title    string `json:"title"`
+		AppID    string `json:"appid"`
+		PagePath string `json:"pagepath"`
+		Thumb    string `json:"thumb_media_id"`
+	}{title, appid, pagepath, thumbMediaid}
+	return reply
+}
+
+// WithKfAccount 以指定客服账号发送消息
+func (reply CSMsgReply) WithKfAccount(account string) CSMsgReply {
+	reply.fields["customservice"] = struct {
+		Account string `json:"kf_account"`
+	}{account}
+	return reply
 }
 
 // SendCSMsg 发送客服消息
 func (c *WXClient) SendCSMsg(msg CSMsgReply) error {
+	return c.SendCSMsgContext(context.Background(), msg)
+}
+
+// SendCSMsgContext 发送客服消息
+func (c *WXClient) SendCSMsgContext(ctx context.Context, msg CSMsgReply) error {
 	const uri = "https://api.weixin.qq.com/cgi-bin/message/custom/send?access_token=%s"
-	token, _ := c.getAccessToken()
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return err
+	}
 	var result struct {
 		ErrCode int    `json:"errcode"`
 		ErrMsg  string `json:"errmsg"`
 	}
-	err := c.httpPost(fmt.Sprintf(uri, token), msg.data(), &result)
+	err = c.httpPost(ctx, fmt.Sprintf(uri, token), msg.data(), &result)
 	if err != nil {
 		return err
 	}
 	if result.ErrCode != 0 {
-		return fmt.Errorf("%d-%s", result.ErrCode, result.ErrMsg)
+		return NewAPIError(result.ErrCode, result.ErrMsg)
 	}
 	return nil
 }
@@ -0,0 +1,81 @@
+// 消息排重
+
+package wxdev
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DedupStore 消息排重存储
+type DedupStore interface {
+	// Add 记录key, key在ttl内已存在时返回false
+	Add(key string, ttl time.Duration) bool
+	// Remove 删除key, 消息处理失败时撤销记录以便处理微信的重试推送
+	Remove(key string)
+}
+
+type lruEntry struct {
+	key         string
+	expiredTime time.Time
+}
+
+// LRUDedupStore 基于LRU淘汰的内存排重存储
+type LRUDedupStore struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+// NewLRUDedupStore 创建LRU排重存储, capacity 为最多保留的key数量
+func NewLRUDedupStore(capacity int) *LRUDedupStore {
+	return &LRUDedupStore{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Add 记录key, key在ttl内已存在时返回false
+func (s *LRUDedupStore) Add(key string, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if e, has := s.items[key]; has {
+		entry := e.Value.(*lruEntry)
+		s.ll.MoveToFront(e)
+		if now.Before(entry.expiredTime) {
+			return false
+		}
+		entry.expiredTime = now.Add(ttl)
+		return true
+	}
+	s.items[key] = s.ll.PushFront(&lruEntry{key: key, expiredTime: now.Add(ttl)})
+	for s.capacity > 0 && s.ll.Len() > s.capacity {
+		e := s.ll.Back()
+		s.ll.Remove(e)
+		delete(s.items, e.Value.(*lruEntry).key)
+	}
+	return true
+}
+
+// Remove 删除key
+func (s *LRUDedupStore) Remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, has := s.items[key]; has {
+		s.ll.Remove(e)
+		delete(s.items, key)
+	}
+}
+
+// DedupKey 消息排重键, 普通消息使用MsgId, 事件使用FromUserName+CreateTime+Event+EventKey
+func (r WXMessageRequest) DedupKey() string {
+	if r.IsEvent() {
+		return fmt.Sprintf("%s_%d_%s_%s", r.FromUserName, r.CreateTime, r.Event, r.EventKey)
+	}
+	return fmt.Sprintf("%d", r.MsgId)
+}
@@ -0,0 +1,47 @@
+// 微信接口错误
+
+package wxdev
+
+import "github.com/shengzhi/wxdev/wxerr"
+
+// 常见全局返回码
+const (
+	ErrCodeInvalidCredential  = wxerr.ErrCodeInvalidCredential  // access_token无效或不是最新的
+	ErrCodeInvalidAccessToken = wxerr.ErrCodeInvalidAccessToken // 不合法的access_token
+	ErrCodeAccessTokenExpired = wxerr.ErrCodeAccessTokenExpired // access_token超时
+	ErrCodeUserRefused        = wxerr.ErrCodeUserRefused        // 用户拒绝接受消息
+	ErrCodeAPIDailyLimit      = wxerr.ErrCodeAPIDailyLimit      // 接口调用超过日限制
+	ErrCodeAPIMinuteLimit     = wxerr.ErrCodeAPIMinuteLimit     // 接口调用频率超过限制
+)
+
+// APIError 微信接口返回的错误, 与 wxerr.APIError 为同一类型
+type APIError = wxerr.APIError
+
+// NewAPIError 根据errcode/errmsg创建错误, 自动提取errmsg中的rid
+func NewAPIError(code int, msg string) *APIError { return wxerr.NewAPIError(code, msg) }
+
+// ErrCode 返回err中的微信错误码, 非APIError时返回0
+func ErrCode(err error) int { return wxerr.ErrCode(err) }
+
+// IsTokenExpired access_token是否无效或已过期
+func IsTokenExpired(err error) bool { return wxerr.IsTokenExpired(err) }
+
+// IsRateLimited 是否触发接口调用频率或次数限制
+func IsRateLimited(err error) bool { return wxerr.IsRateLimited(err) }
+
+// IsUserRefused 用户是否拒绝接受消息
+func IsUserRefused(err error) bool { return wxerr.IsUserRefused(err) }
+
+// apiReply 微信接口通用返回
+type apiReply struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+// Error 返回 *APIError, errcode为0时返回nil
+func (r apiReply) Error() error {
+	if r.ErrCode == 0 {
+		return nil
+	}
+	return NewAPIError(r.ErrCode, r.ErrMsg)
+}
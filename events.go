@@ -0,0 +1,187 @@
+// 事件推送
+
+package wxdev
+
+// 事件类型定义
+const (
+	// 模板消息发送结果
+	EventTypeTmplSendJobFinish WXEventType = "TEMPLATESENDJOBFINISH"
+	// 群发结果
+	EventTypeMassSendJobFinish WXEventType = "MASSSENDJOBFINISH"
+	// 点击菜单跳转小程序
+	EventTypeViewMiniProgram WXEventType = "view_miniprogram"
+	// 订阅通知
+	EventTypeSubscribeMsgPopup  WXEventType = "subscribe_msg_popup_event"
+	EventTypeSubscribeMsgChange WXEventType = "subscribe_msg_change_event"
+	EventTypeSubscribeMsgSent   WXEventType = "subscribe_msg_sent_event"
+	// 发布结果
+	EventTypePublishJobFinish WXEventType = "PUBLISHJOBFINISH"
+	// 卡券事件
+	EventTypeCardPassCheck            WXEventType = "card_pass_check"
+	EventTypeCardNotPassCheck         WXEventType = "card_not_pass_check"
+	EventTypeUserGetCard              WXEventType = "user_get_card"
+	EventTypeUserGiftingCard          WXEventType = "user_gifting_card"
+	EventTypeUserDelCard              WXEventType = "user_del_card"
+	EventTypeUserConsumeCard          WXEventType = "user_consume_card"
+	EventTypeUserPayFromPayCell       WXEventType = "user_pay_from_pay_cell"
+	EventTypeUserViewCard             WXEventType = "user_view_card"
+	EventTypeUserEnterSessionFromCard WXEventType = "user_enter_session_from_card"
+	EventTypeUpdateMemberCard         WXEventType = "update_member_card"
+	EventTypeCardSkuRemind            WXEventType = "card_sku_remind"
+	EventTypeCardPayOrder             WXEventType = "card_pay_order"
+	EventTypeSubmitMemberCardUserInfo WXEventType = "submit_membercard_user_info"
+	// 微信认证事件
+	EventTypeQualificationVerifySuccess WXEventType = "qualification_verify_success"
+	EventTypeQualificationVerifyFail    WXEventType = "qualification_verify_fail"
+	EventTypeNamingVerifySuccess        WXEventType = "naming_verify_success"
+	EventTypeNamingVerifyFail           WXEventType = "naming_verify_fail"
+	EventTypeAnnualRenew                WXEventType = "annual_renew"
+	EventTypeVerifyExpired              WXEventType = "verify_expired"
+)
+
+// 订阅通知状态
+const (
+	SubscribeStatusAccept = "accept"
+	SubscribeStatusReject = "reject"
+)
+
+// ArticleURLResult 群发图文消息的文章链接
+type ArticleURLResult struct {
+	Count      int                    `xml:",omitempty"`
+	ResultList []ArticleURLResultItem `xml:"ResultList>item,omitempty"`
+}
+
+// ArticleURLResultItem 群发文章链接
+type ArticleURLResultItem struct {
+	ArticleIdx int    `xml:",omitempty"`
+	ArticleUrl string `xml:",omitempty"`
+}
+
+// CopyrightCheckResult 群发原创校验结果
+type CopyrightCheckResult struct {
+	Count      int                        `xml:",omitempty"`
+	ResultList []CopyrightCheckResultItem `xml:"ResultList>item,omitempty"`
+	CheckState int                        `xml:",omitempty"`
+}
+
+// CopyrightCheckResultItem 单篇文章原创校验结果
+type CopyrightCheckResultItem struct {
+	ArticleIdx            int    `xml:",omitempty"`
+	UserDeclareState      int    `xml:",omitempty"`
+	AuditState            int    `xml:",omitempty"`
+	OriginalArticleUrl    string `xml:",omitempty"`
+	OriginalArticleType   int    `xml:",omitempty"`
+	CanReprint            int    `xml:",omitempty"`
+	NeedReplaceContent    int    `xml:",omitempty"`
+	NeedShowReprintSource int    `xml:",omitempty"`
+}
+
+// MassSendEventInfo 群发结果事件
+type MassSendEventInfo struct {
+	TotalCount           int                   `xml:",omitempty"`
+	FilterCount          int                   `xml:",omitempty"`
+	SentCount            int                   `xml:",omitempty"`
+	ErrorCount           int                   `xml:",omitempty"`
+	CopyrightCheckResult *CopyrightCheckResult `xml:",omitempty"`
+	ArticleUrlResult     *ArticleURLResult     `xml:",omitempty"`
+}
+
+// SubscribeMsgPopupItem 用户在订阅通知弹窗中的操作
+type SubscribeMsgPopupItem struct {
+	TemplateId            string `xml:",omitempty"`
+	SubscribeStatusString string `xml:",omitempty"`
+	PopupScene            int    `xml:",omitempty"` // 0:H5, 1:支付后, 2:小程序内(不会出现在公众号推送中)
+}
+
+// SubscribeMsgChangeItem 用户在服务通知管理页面的订阅变更
+type SubscribeMsgChangeItem struct {
+	TemplateId            string `xml:",omitempty"`
+	SubscribeStatusString string `xml:",omitempty"`
+}
+
+// SubscribeMsgSentItem 订阅通知发送结果
+type SubscribeMsgSentItem struct {
+	TemplateId  string `xml:",omitempty"`
+	MsgID       string `xml:",omitempty"`
+	ErrorCode   int    `xml:",omitempty"`
+	ErrorStatus string `xml:",omitempty"`
+}
+
+// SubscribeMsgPopupEvent 订阅通知弹窗事件
+type SubscribeMsgPopupEvent struct {
+	List []SubscribeMsgPopupItem `xml:",omitempty"`
+}
+
+// SubscribeMsgChangeEvent 订阅通知变更事件
+type SubscribeMsgChangeEvent struct {
+	List []SubscribeMsgChangeItem `xml:",omitempty"`
+}
+
+// SubscribeMsgSentEvent 订阅通知发送结果事件
+type SubscribeMsgSentEvent struct {
+	List []SubscribeMsgSentItem `xml:",omitempty"`
+}
+
+// PublishEventInfo 发布结果, publish_status 0:成功, 1:发布中, 2:原创失败, 3:常规失败, 4:平台审核不通过, 5:成功后用户删除所有文章, 6:成功后系统封禁所有文章
+type PublishEventInfo struct {
+	PublishID     string `xml:"publish_id,omitempty"`
+	PublishStatus int    `xml:"publish_status"`
+	ArticleID     string `xml:"article_id,omitempty"`
+	ArticleDetail struct {
+		Count int                  `xml:"count,omitempty"`
+		Items []PublishArticleItem `xml:"item,omitempty"`
+	} `xml:"article_detail,omitempty"`
+	FailIdx []int `xml:"fail_idx,omitempty"`
+}
+
+// PublishArticleItem 发布成功的文章
+type PublishArticleItem struct {
+	Idx        int    `xml:"idx,omitempty"`
+	ArticleURL string `xml:"article_url,omitempty"`
+}
+
+// CardEventInfo 卡券事件
+type CardEventInfo struct {
+	CardId              string `xml:",omitempty"`
+	RefuseReason        string `xml:",omitempty"` // 审核不通过原因
+	IsGiveByFriend      int    `xml:",omitempty"`
+	FriendUserName      string `xml:",omitempty"`
+	UserCardCode        string `xml:",omitempty"`
+	OldUserCardCode     string `xml:",omitempty"`
+	OuterId             int    `xml:",omitempty"`
+	OuterStr            string `xml:",omitempty"`
+	IsRestoreMemberCard int    `xml:",omitempty"`
+	UnionId             string `xml:",omitempty"`
+	IsReturnBack        int    `xml:",omitempty"` // 转赠退回
+	IsChatRoom          int    `xml:",omitempty"` // 是否转赠到群
+	ConsumeSource       string `xml:",omitempty"` // 核销来源
+	LocationName        string `xml:",omitempty"`
+	LocationId          int64  `xml:",omitempty"`
+	StaffOpenId         string `xml:",omitempty"`
+	VerifyCode          string `xml:",omitempty"`
+	RemarkAmount        string `xml:",omitempty"`
+	TransId             string `xml:",omitempty"` // 买单事件微信支付交易订单号
+	Fee                 int    `xml:",omitempty"`
+	OriginalFee         int    `xml:",omitempty"`
+	ModifyBonus         int    `xml:",omitempty"` // 会员卡积分变化值
+	ModifyBalance       int    `xml:",omitempty"` // 会员卡余额变化值
+	Detail              string `xml:",omitempty"` // 库存报警详情
+	OrderId             string `xml:",omitempty"` // 券点流水单号
+	CreateOrderTime     int64  `xml:",omitempty"`
+	PayFinishTime       int64  `xml:",omitempty"`
+	Desc                string `xml:",omitempty"`
+	FreeCoinCount       string `xml:",omitempty"`
+	PayCoinCount        string `xml:",omitempty"`
+	RefundFreeCoinCount string `xml:",omitempty"`
+	RefundPayCoinCount  string `xml:",omitempty"`
+	OrderType           string `xml:",omitempty"`
+	Memo                string `xml:",omitempty"`
+	ReceiptInfo         string `xml:",omitempty"`
+}
+
+// VerifyEventInfo 微信认证事件
+type VerifyEventInfo struct {
+	ExpiredTime int64  `xml:",omitempty"` // 有效期(整型), 指的是时间戳
+	FailTime    int64  `xml:",omitempty"`
+	FailReason  string `xml:",omitempty"`
+}
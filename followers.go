@@ -0,0 +1,115 @@
+// 关注者列表
+
+package wxdev
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// FollowerPage 关注者列表分页
+type FollowerPage struct {
+	Total   int      // 关注者总数
+	OpenIDs []string // 本页的openid, 每页最多10000个
+	NextID  string   // 拉取下一页使用的next_openid
+}
+
+// GetFollowers 获取关注者列表, nextOpenID 为空时从头开始拉取
+func (c *WXClient) GetFollowers(nextOpenID string) (FollowerPage, error) {
+	return c.GetFollowersContext(context.Background(), nextOpenID)
+}
+
+// GetFollowersContext 获取关注者列表, nextOpenID 为空时从头开始拉取
+func (c *WXClient) GetFollowersContext(ctx context.Context, nextOpenID string) (FollowerPage, error) {
+	const uri = "https://api.weixin.qq.com/cgi-bin/user/get?access_token=%s&next_openid=%s"
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return FollowerPage{}, err
+	}
+	var result struct {
+		apiReply
+		Total int `json:"total"`
+		Count int `json:"count"`
+		Data  struct {
+			OpenIDs []string `json:"openid"`
+		} `json:"data"`
+		NextOpenID string `json:"next_openid"`
+	}
+	if err = c.httpGet(ctx, fmt.Sprintf(uri, token, url.QueryEscape(nextOpenID)), &result); err != nil {
+		return FollowerPage{}, err
+	}
+	if err = result.Error(); err != nil {
+		return FollowerPage{}, err
+	}
+	return FollowerPage{Total: result.Total, OpenIDs: result.Data.OpenIDs, NextID: result.NextOpenID}, nil
+}
+
+// ListFollowers 按next_openid分页遍历所有关注者openid
+func (c *WXClient) ListFollowers(ctx context.Context) *PageIterator[string] {
+	return iterateOpenIDs(ctx, c.GetFollowersContext)
+}
+
+// IterateFollowerInfo 遍历所有关注者并按每100个一批获取用户信息,
+// 最多 concurrency 个批次并发请求, fn 按批次串行调用, 返回错误时停止遍历
+func (c *WXClient) IterateFollowerInfo(ctx context.Context, concurrency int, fn func([]WXUserInfo) error) error {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, concurrency)
+	)
+	setErr := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	dispatch := func(openids []string) {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			users, err := c.BatchGetUserInfoContext(ctx, openids...)
+			if err == nil {
+				mu.Lock()
+				if firstErr == nil {
+					err = fn(users)
+				}
+				mu.Unlock()
+			}
+			if err != nil {
+				setErr(err)
+			}
+		}()
+	}
+
+	it := c.ListFollowers(ctx)
+	batch := make([]string, 0, 100)
+	for it.Next() {
+		if batch = append(batch, it.Item()); len(batch) == 100 {
+			dispatch(batch)
+			batch = make([]string, 0, 100)
+		}
+	}
+	if len(batch) > 0 {
+		dispatch(batch)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return it.Err()
+}
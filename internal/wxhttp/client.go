@@ -0,0 +1,212 @@
+// Package wxhttp 公众号及小程序客户端共用的接口调用逻辑,
+// 包括接口域名改写、调试输出、access_token失效时强制刷新并重试以及Token server请求
+package wxhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/shengzhi/wxdev/wxerr"
+)
+
+// Client 微信接口HTTP客户端
+type Client struct {
+	HTTPClient *http.Client
+	// BaseURL 不为空时将微信接口域名替换为该地址
+	BaseURL *url.URL
+	Debug   bool
+	// Refresh 强制刷新access_token, stale 为已失效的token
+	Refresh func(ctx context.Context, stale string) (string, error)
+	// SignRequest 对Token server请求签名
+	SignRequest func(req *http.Request)
+}
+
+// Response 接口返回
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// apiHosts 微信接口域名
+var apiHosts = map[string]bool{
+	"api.weixin.qq.com":      true,
+	"file.api.weixin.qq.com": true,
+	"mp.weixin.qq.com":       true,
+}
+
+// rewriteURL 按 BaseURL 改写微信接口地址
+func (c *Client) rewriteURL(req *http.Request) {
+	if c.BaseURL == nil || !apiHosts[req.URL.Host] {
+		return
+	}
+	req.URL.Scheme, req.URL.Host = c.BaseURL.Scheme, c.BaseURL.Host
+	req.URL.Path = strings.TrimSuffix(c.BaseURL.Path, "/") + req.URL.Path
+	req.Host = c.BaseURL.Host
+}
+
+// Do 发送请求
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	c.rewriteURL(req)
+	if c.Debug {
+		data, _ := httputil.DumpRequest(req, true)
+		fmt.Println(string(data))
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if resp != nil && c.Debug {
+		data, _ := httputil.DumpResponse(resp, true)
+		fmt.Println(string(data))
+	}
+	return resp, err
+}
+
+// Request 发送请求并读取返回内容, 不做重试
+func (c *Client) Request(ctx context.Context, method, uri string, body []byte, contentType string) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, uri, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := c.Do(req)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{StatusCode: res.StatusCode, Header: res.Header, Body: data}, nil
+}
+
+// Call 调用接口并解析JSON结果, access_token失效时强制刷新并重试一次
+func (c *Client) Call(ctx context.Context, method, uri string, body []byte, contentType string, v interface{}) error {
+	resp, err := c.send(ctx, method, uri, body, contentType)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(resp.Body, v)
+}
+
+// Download 下载文件等非JSON内容, access_token失效时强制刷新并重试一次,
+// 接口以JSON返回错误码或HTTP状态码不为200时返回错误
+func (c *Client) Download(ctx context.Context, method, uri string, body []byte, contentType string) (*Response, error) {
+	resp, err := c.send(ctx, method, uri, body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if code, msg := errReply(resp.Body); code != 0 {
+		return nil, wxerr.NewAPIError(code, msg)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected status %d: %s", resp.StatusCode, string(resp.Body))
+	}
+	return resp, nil
+}
+
+// FileName 返回 Content-Disposition 中的文件名
+func (r *Response) FileName() string {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition"))
+	if err != nil {
+		return ""
+	}
+	return params["filename"]
+}
+
+// send 发送请求, 返回access_token失效错误时强制刷新并重试一次
+func (c *Client) send(ctx context.Context, method, uri string, body []byte, contentType string) (*Response, error) {
+	resp, err := c.Request(ctx, method, uri, body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	stale := tokenInURL(uri)
+	if stale == "" || c.Refresh == nil {
+		return resp, nil
+	}
+	if code, _ := errReply(resp.Body); !wxerr.IsTokenExpiredCode(code) {
+		return resp, nil
+	}
+	token, err := c.Refresh(ctx, stale)
+	if err != nil || token == stale {
+		if c.Debug {
+			fmt.Printf("refresh access_token failed, error:%v\n", err)
+		}
+		return resp, nil
+	}
+	return c.Request(ctx, method, replaceTokenInURL(uri, token), body, contentType)
+}
+
+// errReply 解析返回内容中的errcode/errmsg, 非JSON时返回0
+func errReply(data []byte) (int, string) {
+	var reply struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return 0, ""
+	}
+	return reply.ErrCode, reply.ErrMsg
+}
+
+// tokenInURL 返回请求地址中的access_token
+func tokenInURL(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("access_token")
+}
+
+// replaceTokenInURL 替换请求地址中的access_token
+func replaceTokenInURL(uri, token string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	q := u.Query()
+	q.Set("access_token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// TokenServerGet 请求Token server, 设置了 SignRequest 时对请求签名
+func (c *Client) TokenServerGet(ctx context.Context, uri string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return err
+	}
+	if c.SignRequest != nil {
+		c.SignRequest(req)
+	}
+	res, err := c.Do(req)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Token server responded %d: %s", res.StatusCode, string(data))
+	}
+	// Token server 出错时仍返回200, 错误码位于errcode
+	if code, msg := errReply(data); code != 0 {
+		return wxerr.NewAPIError(code, msg)
+	}
+	return json.Unmarshal(data, v)
+}
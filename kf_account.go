@@ -0,0 +1,321 @@
+// 客服账号及会话管理
+
+package wxdev
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	url_kfAdd           = "https://api.weixin.qq.com/customservice/kfaccount/add?access_token=%s"
+	url_kfUpdate        = "https://api.weixin.qq.com/customservice/kfaccount/update?access_token=%s"
+	url_kfDel           = "https://api.weixin.qq.com/customservice/kfaccount/del?access_token=%s&kf_account=%s"
+	url_kfInvite        = "https://api.weixin.qq.com/customservice/kfaccount/inviteworker?access_token=%s"
+	url_kfUploadHeadImg = "https://api.weixin.qq.com/customservice/kfaccount/uploadheadimg?access_token=%s&kf_account=%s"
+	url_kfList          = "https://api.weixin.qq.com/cgi-bin/customservice/getkflist?access_token=%s"
+	url_kfOnlineList    = "https://api.weixin.qq.com/cgi-bin/customservice/getonlinekflist?access_token=%s"
+	url_kfSessionCreate = "https://api.weixin.qq.com/customservice/kfsession/create?access_token=%s"
+	url_kfSessionClose  = "https://api.weixin.qq.com/customservice/kfsession/close?access_token=%s"
+	url_kfSessionGet    = "https://api.weixin.qq.com/customservice/kfsession/getsession?access_token=%s&openid=%s"
+	url_kfSessionList   = "https://api.weixin.qq.com/customservice/kfsession/getsessionlist?access_token=%s&kf_account=%s"
+	url_kfWaitCase      = "https://api.weixin.qq.com/customservice/kfsession/getwaitcase?access_token=%s"
+	url_kfMsgRecord     = "https://api.weixin.qq.com/customservice/msgrecord/getmsglist?access_token=%s"
+)
+
+// KfAccount 客服账号
+type KfAccount struct {
+	Account    string `json:"kf_account"` // 完整客服账号, 格式为:账号前缀@公众号微信号
+	Nick       string `json:"kf_nick"`
+	ID         string `json:"kf_id"`
+	HeadImgURL string `json:"kf_headimgurl"`
+	Wx         string `json:"kf_wx"` // 已绑定的客服微信号
+	// 邀请绑定的微信号及邀请状态(waiting/rejected/expired)
+	InviteWx         string `json:"invite_wx"`
+	InviteExpireTime int64  `json:"invite_expire_time"`
+	InviteStatus     string `json:"invite_status"`
+}
+
+// KfOnline 在线客服
+type KfOnline struct {
+	Account      string `json:"kf_account"`
+	Status       int    `json:"status"` // 客服在线状态, 目前为1:web在线
+	ID           string `json:"kf_id"`
+	AcceptedCase int    `json:"accepted_case"` // 正在接待的会话数
+}
+
+// AddKfAccount 添加客服账号
+func (c *WXClient) AddKfAccount(account, nickname string) error {
+	return c.AddKfAccountContext(context.Background(), account, nickname)
+}
+
+// AddKfAccountContext 添加客服账号
+func (c *WXClient) AddKfAccountContext(ctx context.Context, account, nickname string) error {
+	return c.kfPost(ctx, url_kfAdd, map[string]string{"kf_account": account, "nickname": nickname})
+}
+
+// UpdateKfAccount 设置客服昵称
+func (c *WXClient) UpdateKfAccount(account, nickname string) error {
+	return c.UpdateKfAccountContext(context.Background(), account, nickname)
+}
+
+// UpdateKfAccountContext 设置客服昵称
+func (c *WXClient) UpdateKfAccountContext(ctx context.Context, account, nickname string) error {
+	return c.kfPost(ctx, url_kfUpdate, map[string]string{"kf_account": account, "nickname": nickname})
+}
+
+// DeleteKfAccount 删除客服账号
+func (c *WXClient) DeleteKfAccount(account string) error {
+	return c.DeleteKfAccountContext(context.Background(), account)
+}
+
+// DeleteKfAccountContext 删除客服账号
+func (c *WXClient) DeleteKfAccountContext(ctx context.Context, account string) error {
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	var result apiReply
+	if err = c.httpGet(ctx, fmt.Sprintf(url_kfDel, token, url.QueryEscape(account)), &result); err != nil {
+		return err
+	}
+	return result.Error()
+}
+
+// InviteKfWorker 邀请微信用户绑定客服账号, 对方需在微信中确认
+func (c *WXClient) InviteKfWorker(account, wx string) error {
+	return c.InviteKfWorkerContext(context.Background(), account, wx)
+}
+
+// InviteKfWorkerContext 邀请微信用户绑定客服账号, 对方需在微信中确认
+func (c *WXClient) InviteKfWorkerContext(ctx context.Context, account, wx string) error {
+	return c.kfPost(ctx, url_kfInvite, map[string]string{"kf_account": account, "invite_wx": wx})
+}
+
+// UploadKfHeadImgFile 上传客服头像, 头像图片为jpg格式, 推荐640*640
+func (c *WXClient) UploadKfHeadImgFile(account, filename string) error {
+	return c.UploadKfHeadImgFileContext(context.Background(), account, filename)
+}
+
+// UploadKfHeadImgFileContext 上传客服头像
+func (c *WXClient) UploadKfHeadImgFileContext(ctx context.Context, account, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return c.UploadKfHeadImgContext(ctx, account, filepath.Base(filename), file)
+}
+
+// UploadKfHeadImg 上传客服头像
+func (c *WXClient) UploadKfHeadImg(account, filename string, file io.Reader) error {
+	return c.UploadKfHeadImgContext(context.Background(), account, filename, file)
+}
+
+// UploadKfHeadImgContext 上传客服头像
+func (c *WXClient) UploadKfHeadImgContext(ctx context.Context, account, filename string, file io.Reader) error {
+	body, contentType, err := multipartBody("media", filename, file, nil)
+	if err != nil {
+		return err
+	}
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	var result apiReply
+	uri := fmt.Sprintf(url_kfUploadHeadImg, token, url.QueryEscape(account))
+	if err = c.callAPI(ctx, "POST", uri, body, contentType, &result); err != nil {
+		return err
+	}
+	return result.Error()
+}
+
+// GetKfList 获取所有客服账号
+func (c *WXClient) GetKfList() ([]KfAccount, error) {
+	return c.GetKfListContext(context.Background())
+}
+
+// GetKfListContext 获取所有客服账号
+func (c *WXClient) GetKfListContext(ctx context.Context) ([]KfAccount, error) {
+	var result struct {
+		apiReply
+		List []KfAccount `json:"kf_list"`
+	}
+	if err := c.kfGet(ctx, &result, url_kfList); err != nil {
+		return nil, err
+	}
+	return result.List, result.Error()
+}
+
+// GetOnlineKfList 获取在线客服
+func (c *WXClient) GetOnlineKfList() ([]KfOnline, error) {
+	return c.GetOnlineKfListContext(context.Background())
+}
+
+// GetOnlineKfListContext 获取在线客服
+func (c *WXClient) GetOnlineKfListContext(ctx context.Context) ([]KfOnline, error) {
+	var result struct {
+		apiReply
+		List []KfOnline `json:"kf_online_list"`
+	}
+	if err := c.kfGet(ctx, &result, url_kfOnlineList); err != nil {
+		return nil, err
+	}
+	return result.List, result.Error()
+}
+
+// KfSession 客服会话
+type KfSession struct {
+	Account    string `json:"kf_account"`
+	OpenID     string `json:"openid"`
+	CreateTime int64  `json:"createtime"`
+}
+
+// KfWaitCase 未接入会话
+type KfWaitCase struct {
+	OpenID     string `json:"openid"`
+	LatestTime int64  `json:"latest_time"` // 粉丝的最后一条消息的时间
+}
+
+// CreateKfSession 创建会话, 将用户接入指定客服
+func (c *WXClient) CreateKfSession(account, openid string) error {
+	return c.CreateKfSessionContext(context.Background(), account, openid)
+}
+
+// CreateKfSessionContext 创建会话, 将用户接入指定客服
+func (c *WXClient) CreateKfSessionContext(ctx context.Context, account, openid string) error {
+	return c.kfPost(ctx, url_kfSessionCreate, map[string]string{"kf_account": account, "openid": openid})
+}
+
+// CloseKfSession 关闭会话
+func (c *WXClient) CloseKfSession(account, openid string) error {
+	return c.CloseKfSessionContext(context.Background(), account, openid)
+}
+
+// CloseKfSessionContext 关闭会话
+func (c *WXClient) CloseKfSessionContext(ctx context.Context, account, openid string) error {
+	return c.kfPost(ctx, url_kfSessionClose, map[string]string{"kf_account": account, "openid": openid})
+}
+
+// GetKfSession 获取用户当前的会话状态
+func (c *WXClient) GetKfSession(openid string) (KfSession, error) {
+	return c.GetKfSessionContext(context.Background(), openid)
+}
+
+// GetKfSessionContext 获取用户当前的会话状态
+func (c *WXClient) GetKfSessionContext(ctx context.Context, openid string) (KfSession, error) {
+	var result struct {
+		apiReply
+		KfSession
+	}
+	if err := c.kfGet(ctx, &result, url_kfSessionGet, url.QueryEscape(openid)); err != nil {
+		return KfSession{}, err
+	}
+	result.OpenID = openid
+	return result.KfSession, result.Error()
+}
+
+// GetKfSessionList 获取客服的会话列表
+func (c *WXClient) GetKfSessionList(account string) ([]KfSession, error) {
+	return c.GetKfSessionListContext(context.Background(), account)
+}
+
+// GetKfSessionListContext 获取客服的会话列表
+func (c *WXClient) GetKfSessionListContext(ctx context.Context, account string) ([]KfSession, error) {
+	var result struct {
+		apiReply
+		List []KfSession `json:"sessionlist"`
+	}
+	if err := c.kfGet(ctx, &result, url_kfSessionList, url.QueryEscape(account)); err != nil {
+		return nil, err
+	}
+	for i := range result.List {
+		result.List[i].Account = account
+	}
+	return result.List, result.Error()
+}
+
+// GetKfWaitCase 获取未接入会话列表, 返回未接入会话总数及最早的100个未接入会话
+func (c *WXClient) GetKfWaitCase() (int, []KfWaitCase, error) {
+	return c.GetKfWaitCaseContext(context.Background())
+}
+
+// GetKfWaitCaseContext 获取未接入会话列表
+func (c *WXClient) GetKfWaitCaseContext(ctx context.Context) (int, []KfWaitCase, error) {
+	var result struct {
+		apiReply
+		Count int          `json:"count"`
+		List  []KfWaitCase `json:"waitcaselist"`
+	}
+	if err := c.kfGet(ctx, &result, url_kfWaitCase); err != nil {
+		return 0, nil, err
+	}
+	return result.Count, result.List, result.Error()
+}
+
+// kfGet 请求 fmt.Sprintf(uri, access_token, args...) 并将结果解析至v
+func (c *WXClient) kfGet(ctx context.Context, v interface{}, uri string, args ...interface{}) error {
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	return c.httpGet(ctx, fmt.Sprintf(uri, append([]interface{}{token}, args...)...), v)
+}
+
+func (c *WXClient) kfPost(ctx context.Context, uri string, data interface{}) error {
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	var result apiReply
+	if err = c.httpPost(ctx, fmt.Sprintf(uri, token), data, &result); err != nil {
+		return err
+	}
+	return result.Error()
+}
+
+// KfMsgRecord 客服聊天记录
+type KfMsgRecord struct {
+	OpenID   string `json:"openid"`
+	OperCode int    `json:"opercode"` // 操作码, 2002:客服发送信息, 2003:客服接收消息
+	Text     string `json:"text"`
+	Time     int64  `json:"time"`
+	Worker   string `json:"worker"` // 完整客服账号
+}
+
+// IterateKfMsgRecords 分页获取[start, end]时间段内的聊天记录, 时间段不能超过24小时.
+// pageSize 为每页条数, <=0 或超过10000时为10000, 迭代器的 Total 始终为0
+func (c *WXClient) IterateKfMsgRecords(ctx context.Context, start, end time.Time, pageSize int) *PageIterator[KfMsgRecord] {
+	if pageSize <= 0 || pageSize > 10000 {
+		pageSize = 10000
+	}
+	data := map[string]int64{
+		"starttime": start.Unix(), "endtime": end.Unix(), "msgid": 1, "number": int64(pageSize),
+	}
+	return newPageIterator(func() ([]KfMsgRecord, int, bool, error) {
+		token, err := c.getAccessToken(ctx)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		var result struct {
+			apiReply
+			List   []KfMsgRecord `json:"recordlist"`
+			Number int           `json:"number"`
+			MsgID  int64         `json:"msgid"`
+		}
+		if err = c.httpPost(ctx, fmt.Sprintf(url_kfMsgRecord, token), data, &result); err != nil {
+			return nil, 0, false, err
+		}
+		if err = result.Error(); err != nil {
+			return nil, 0, false, err
+		}
+		data["msgid"] = result.MsgID
+		// 返回条数小于请求条数时表示已无更多记录
+		return result.List, 0, result.Number < pageSize || len(result.List) == 0, nil
+	})
+}
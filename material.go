@@ -0,0 +1,314 @@
+// 永久素材
+
+package wxdev
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/shengzhi/wxdev/internal/wxhttp"
+)
+
+// StuffTypeNews 图文素材, 仅用于获取素材列表
+const StuffTypeNews StuffType = "news"
+
+const (
+	url_materialAdd       = "https://api.weixin.qq.com/cgi-bin/material/add_material?access_token=%s&type=%s"
+	url_materialUploadImg = "https://api.weixin.qq.com/cgi-bin/media/uploadimg?access_token=%s"
+	url_materialGet       = "https://api.weixin.qq.com/cgi-bin/material/get_material?access_token=%s"
+	url_materialDel       = "https://api.weixin.qq.com/cgi-bin/material/del_material?access_token=%s"
+	url_materialCount     = "https://api.weixin.qq.com/cgi-bin/material/get_materialcount?access_token=%s"
+	url_materialBatchGet  = "https://api.weixin.qq.com/cgi-bin/material/batchget_material?access_token=%s"
+)
+
+// Material 新增的永久素材
+type Material struct {
+	MediaID string `json:"media_id"`
+	URL     string `json:"url"` // 图片素材的URL, 仅限腾讯系域名内使用
+}
+
+// AddMaterialFile 上传文件至永久素材库, 视频素材请使用 AddVideoMaterial
+func (c *WXClient) AddMaterialFile(t StuffType, filename string) (Material, error) {
+	return c.AddMaterialFileContext(context.Background(), t, filename)
+}
+
+// AddMaterialFileContext 上传文件至永久素材库, 视频素材请使用 AddVideoMaterialContext
+func (c *WXClient) AddMaterialFileContext(ctx context.Context, t StuffType, filename string) (Material, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return Material{}, err
+	}
+	defer file.Close()
+	return c.AddMaterialContext(ctx, t, filepath.Base(filename), file)
+}
+
+// AddMaterial 新增图片、语音或缩略图永久素材
+func (c *WXClient) AddMaterial(t StuffType, filename string, file io.Reader) (Material, error) {
+	return c.AddMaterialContext(context.Background(), t, filename, file)
+}
+
+// AddMaterialContext 新增图片、语音或缩略图永久素材
+func (c *WXClient) AddMaterialContext(ctx context.Context, t StuffType, filename string, file io.Reader) (Material, error) {
+	return c.addMaterial(ctx, t, filename, file, nil)
+}
+
+// AddVideoMaterial 新增视频永久素材
+func (c *WXClient) AddVideoMaterial(filename string, file io.Reader, title, introduction string) (Material, error) {
+	return c.AddVideoMaterialContext(context.Background(), filename, file, title, introduction)
+}
+
+// AddVideoMaterialContext 新增视频永久素材
+func (c *WXClient) AddVideoMaterialContext(ctx context.Context, filename string, file io.Reader, title, introduction string) (Material, error) {
+	desc, err := json.Marshal(map[string]string{"title": title, "introduction": introduction})
+	if err != nil {
+		return Material{}, err
+	}
+	return c.addMaterial(ctx, StuffTypeVideo, filename, file, map[string]string{"description": string(desc)})
+}
+
+func (c *WXClient) addMaterial(ctx context.Context, t StuffType, filename string, file io.Reader, fields map[string]string) (Material, error) {
+	body, contentType, err := multipartBody("media", filename, file, fields)
+	if err != nil {
+		return Material{}, err
+	}
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return Material{}, err
+	}
+	var result struct {
+		apiReply
+		Material
+	}
+	if err = c.callAPI(ctx, "POST", fmt.Sprintf(url_materialAdd, token, t), body, contentType, &result); err != nil {
+		return Material{}, err
+	}
+	return result.Material, result.Error()
+}
+
+// UploadArticleImage 上传图文消息内的图片, 返回图片URL, 不占用素材库限额
+func (c *WXClient) UploadArticleImage(filename string, file io.Reader) (string, error) {
+	return c.UploadArticleImageContext(context.Background(), filename, file)
+}
+
+// UploadArticleImageContext 上传图文消息内的图片, 返回图片URL, 不占用素材库限额
+func (c *WXClient) UploadArticleImageContext(ctx context.Context, filename string, file io.Reader) (string, error) {
+	body, contentType, err := multipartBody("media", filename, file, nil)
+	if err != nil {
+		return "", err
+	}
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		apiReply
+		URL string `json:"url"`
+	}
+	if err = c.callAPI(ctx, "POST", fmt.Sprintf(url_materialUploadImg, token), body, contentType, &result); err != nil {
+		return "", err
+	}
+	return result.URL, result.Error()
+}
+
+// GetMaterial 下载图片、语音或缩略图永久素材
+func (c *WXClient) GetMaterial(mediaid string) (MediaObject, error) {
+	return c.GetMaterialContext(context.Background(), mediaid)
+}
+
+// GetMaterialContext 下载图片、语音或缩略图永久素材
+func (c *WXClient) GetMaterialContext(ctx context.Context, mediaid string) (MediaObject, error) {
+	var obj MediaObject
+	resp, err := c.getMaterial(ctx, mediaid)
+	if err != nil {
+		return obj, err
+	}
+	// 视频及图文素材返回JSON
+	if bytes.HasPrefix(bytes.TrimSpace(resp.Body), []byte("{")) {
+		return obj, fmt.Errorf("WXDev: material %s is not a file", mediaid)
+	}
+	obj.Type = resp.Header.Get("Content-Type")
+	obj.Data = ioutil.NopCloser(bytes.NewReader(resp.Body))
+	obj.Size = int64(len(resp.Body))
+	obj.FileName = resp.FileName()
+	return obj, nil
+}
+
+// VideoMaterial 视频永久素材
+type VideoMaterial struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	DownURL     string `json:"down_url"`
+}
+
+// GetVideoMaterial 获取视频永久素材
+func (c *WXClient) GetVideoMaterial(mediaid string) (VideoMaterial, error) {
+	return c.GetVideoMaterialContext(context.Background(), mediaid)
+}
+
+// GetVideoMaterialContext 获取视频永久素材
+func (c *WXClient) GetVideoMaterialContext(ctx context.Context, mediaid string) (VideoMaterial, error) {
+	var result VideoMaterial
+	err := c.getJSONMaterial(ctx, mediaid, &result)
+	return result, err
+}
+
+// NewsArticle 图文素材中的文章
+type NewsArticle struct {
+	Title              string `json:"title"`
+	ThumbMediaID       string `json:"thumb_media_id"`
+	ShowCoverPic       int    `json:"show_cover_pic"`
+	Author             string `json:"author"`
+	Digest             string `json:"digest"`
+	Content            string `json:"content"`
+	URL                string `json:"url"`
+	ContentSourceURL   string `json:"content_source_url"`
+	NeedOpenComment    int    `json:"need_open_comment"`
+	OnlyFansCanComment int    `json:"only_fans_can_comment"`
+	ThumbURL           string `json:"thumb_url"`
+}
+
+// GetNewsMaterial 获取图文永久素材
+func (c *WXClient) GetNewsMaterial(mediaid string) ([]NewsArticle, error) {
+	return c.GetNewsMaterialContext(context.Background(), mediaid)
+}
+
+// GetNewsMaterialContext 获取图文永久素材
+func (c *WXClient) GetNewsMaterialContext(ctx context.Context, mediaid string) ([]NewsArticle, error) {
+	var result struct {
+		Items []NewsArticle `json:"news_item"`
+	}
+	err := c.getJSONMaterial(ctx, mediaid, &result)
+	return result.Items, err
+}
+
+// getJSONMaterial 获取以JSON返回的视频及图文素材
+func (c *WXClient) getJSONMaterial(ctx context.Context, mediaid string, v interface{}) error {
+	resp, err := c.getMaterial(ctx, mediaid)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(resp.Body, v)
+}
+
+// getMaterial 请求素材内容, 返回错误码时转换为 *APIError
+func (c *WXClient) getMaterial(ctx context.Context, mediaid string) (*wxhttp.Response, error) {
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	body, _ := json.Marshal(map[string]string{"media_id": mediaid})
+	return c.api.Download(ctx, "POST", fmt.Sprintf(url_materialGet, token), body, "application/json")
+}
+
+// DeleteMaterial 删除永久素材
+func (c *WXClient) DeleteMaterial(mediaid string) error {
+	return c.DeleteMaterialContext(context.Background(), mediaid)
+}
+
+// DeleteMaterialContext 删除永久素材
+func (c *WXClient) DeleteMaterialContext(ctx context.Context, mediaid string) error {
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	var result apiReply
+	if err = c.httpPost(ctx, fmt.Sprintf(url_materialDel, token), map[string]string{"media_id": mediaid}, &result); err != nil {
+		return err
+	}
+	return result.Error()
+}
+
+// MaterialCount 永久素材总数
+type MaterialCount struct {
+	Voice int `json:"voice_count"`
+	Video int `json:"video_count"`
+	Image int `json:"image_count"`
+	News  int `json:"news_count"`
+}
+
+// GetMaterialCount 获取永久素材总数
+func (c *WXClient) GetMaterialCount() (MaterialCount, error) {
+	return c.GetMaterialCountContext(context.Background())
+}
+
+// GetMaterialCountContext 获取永久素材总数
+func (c *WXClient) GetMaterialCountContext(ctx context.Context) (MaterialCount, error) {
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return MaterialCount{}, err
+	}
+	var result struct {
+		apiReply
+		MaterialCount
+	}
+	if err = c.httpGet(ctx, fmt.Sprintf(url_materialCount, token), &result); err != nil {
+		return MaterialCount{}, err
+	}
+	return result.MaterialCount, result.Error()
+}
+
+// MaterialItem 素材列表项, 图文素材的文章位于 Content.NewsItem
+type MaterialItem struct {
+	MediaID    string `json:"media_id"`
+	Name       string `json:"name"`
+	UpdateTime int64  `json:"update_time"`
+	URL        string `json:"url"`
+	Content    *struct {
+		NewsItem []NewsArticle `json:"news_item"`
+	} `json:"content,omitempty"`
+}
+
+// MaterialPage 素材列表分页
+type MaterialPage struct {
+	Total int            `json:"total_count"`
+	Count int            `json:"item_count"`
+	Items []MaterialItem `json:"item"`
+}
+
+// BatchGetMaterial 获取素材列表, count 取值在1到20之间
+func (c *WXClient) BatchGetMaterial(t StuffType, offset, count int) (MaterialPage, error) {
+	return c.BatchGetMaterialContext(context.Background(), t, offset, count)
+}
+
+// BatchGetMaterialContext 获取素材列表, count 取值在1到20之间
+func (c *WXClient) BatchGetMaterialContext(ctx context.Context, t StuffType, offset, count int) (MaterialPage, error) {
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return MaterialPage{}, err
+	}
+	data := struct {
+		Type   StuffType `json:"type"`
+		Offset int       `json:"offset"`
+		Count  int       `json:"count"`
+	}{t, offset, count}
+	var result struct {
+		apiReply
+		MaterialPage
+	}
+	if err = c.httpPost(ctx, fmt.Sprintf(url_materialBatchGet, token), data, &result); err != nil {
+		return MaterialPage{}, err
+	}
+	return result.MaterialPage, result.Error()
+}
+
+// IterateMaterials 分页遍历指定类型的永久素材, pageSize 不在1到20之间时为20
+func (c *WXClient) IterateMaterials(ctx context.Context, t StuffType, pageSize int) *PageIterator[MaterialItem] {
+	if pageSize <= 0 || pageSize > 20 {
+		pageSize = 20
+	}
+	offset := 0
+	return newPageIterator(func() ([]MaterialItem, int, bool, error) {
+		page, err := c.BatchGetMaterialContext(ctx, t, offset, pageSize)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		offset += len(page.Items)
+		return page.Items, page.Total, len(page.Items) == 0 || offset >= page.Total, nil
+	})
+}
@@ -4,17 +4,13 @@ package wxdev
 
 import (
 	"bytes"
-	"crypto/tls"
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
-	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
-	"strings"
 )
 
 // StuffType 素材类型
@@ -32,65 +28,73 @@ const url_uploadMedia = "https://api.weixin.qq.com/cgi-bin/media/upload?access_t
 
 // UploadTempStuffFile 上传文件至临时素材库
 func (c *WXClient) UploadTempStuffFile(t StuffType, filename string) (string, error) {
+	return c.UploadTempStuffFileContext(context.Background(), t, filename)
+}
+
+// UploadTempStuffFileContext 上传文件至临时素材库
+func (c *WXClient) UploadTempStuffFileContext(ctx context.Context, t StuffType, filename string) (string, error) {
 	_, name := filepath.Split(filename)
 	file, err := os.Open(filename)
 	if err != nil {
 		return "", err
 	}
 	defer file.Close()
-	return c.UploadTempStuff(t, name, file)
+	return c.UploadTempStuffContext(ctx, t, name, file)
 }
 
 // UploadTempStuff 上传临时素材
 func (c *WXClient) UploadTempStuff(t StuffType, filename string, file io.Reader) (string, error) {
-	var buf bytes.Buffer
-	w := multipart.NewWriter(&buf)
-	defer w.Close()
-	fw, err := w.CreateFormFile("media", filename)
+	return c.UploadTempStuffContext(context.Background(), t, filename, file)
+}
+
+// UploadTempStuffContext 上传临时素材
+func (c *WXClient) UploadTempStuffContext(ctx context.Context, t StuffType, filename string, file io.Reader) (string, error) {
+	body, contentType, err := multipartBody("media", filename, file, nil)
 	if err != nil {
 		return "", err
 	}
-	_, err = io.CopyBuffer(fw, file, nil)
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return "", err
 	}
-	fmt.Fprintf(&buf, "\r\n--%s--\r\n", w.Boundary())
-	token, _ := c.getAccessToken()
 	uri := fmt.Sprintf(url_uploadMedia, token, t)
-	req, err := http.NewRequest("POST", uri, &buf)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Content-Type", w.FormDataContentType())
-	// reqData, _ := httputil.DumpRequest(req, true)
-	// fmt.Println(string(reqData))
-	client := http.Client{
-		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
-	}
-	resp, err := client.Do(req)
-	if resp != nil {
-		defer resp.Body.Close()
-	}
-	if err != nil {
-		return "", err
-	}
-	// respData, _ := httputil.DumpResponse(resp, true)
-	// fmt.Println(string(respData))
 	var result struct {
 		ErrCode int    `json:"errcode"`
 		ErrMsg  string `json:"errmsg"`
 		MediaID string `json:"media_id"`
 	}
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	err = c.callAPI(ctx, "POST", uri, body, contentType, &result)
 	if err != nil {
 		return "", err
 	}
 	if result.ErrCode != 0 {
-		return "", fmt.Errorf("%d-%s", result.ErrCode, result.ErrMsg)
+		return "", NewAPIError(result.ErrCode, result.ErrMsg)
 	}
 	return result.MediaID, nil
 }
 
+// multipartBody 构造上传文件的表单, fields 为附加的表单字段
+func multipartBody(fieldname, filename string, file io.Reader, fields map[string]string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			return nil, "", err
+		}
+	}
+	fw, err := w.CreateFormFile(fieldname, filename)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err = io.Copy(fw, file); err != nil {
+		return nil, "", err
+	}
+	if err = w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
+
 // MediaObject 多媒体对象
 type MediaObject struct {
 	FileName string
@@ -99,54 +103,54 @@ type MediaObject struct {
 	Size     int64
 }
 
-func (c *WXClient) downloadStuff(uri, mediaid string) (MediaObject, error) {
+func (c *WXClient) downloadStuff(ctx context.Context, uri, mediaid string) (MediaObject, error) {
 	var mediaObj MediaObject
-	token, err := c.getAccessToken()
-	if err != nil {
-		return mediaObj, err
-	}
-	req, _ := http.NewRequest("GET", fmt.Sprintf(uri, token, mediaid), nil)
-	res, err := c.httpDo(req)
-	if res != nil {
-		defer res.Body.Close()
-	}
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return mediaObj, err
 	}
-	var buf bytes.Buffer
-	_, err = io.CopyBuffer(&buf, res.Body, nil)
+	resp, err := c.api.Download(ctx, "GET", fmt.Sprintf(uri, token, mediaid), nil, "")
 	if err != nil {
 		return mediaObj, err
 	}
-	mediaObj.Type = res.Header.Get("Content-Type")
-	mediaObj.Data = ioutil.NopCloser(&buf)
-	mediaObj.Size, _ = strconv.ParseInt(res.Header.Get("Content-Lengt"), 10, 64)
-	disp := res.Header.Get("Content-disposition")
-	if len(disp) > 0 {
-		slice := strings.Split(disp, "filename=")
-		if len(slice) > 1 {
-			mediaObj.FileName = strings.Trim(slice[1], `"`)
-		}
-	}
+	mediaObj.Type = resp.Header.Get("Content-Type")
+	mediaObj.Data = ioutil.NopCloser(bytes.NewReader(resp.Body))
+	mediaObj.Size = int64(len(resp.Body))
+	mediaObj.FileName = resp.FileName()
 	return mediaObj, nil
 }
 
 // DownloadMedia 下载多媒体文件
 func (c *WXClient) DownloadMedia(mediaid string) (MediaObject, error) {
+	return c.DownloadMediaContext(context.Background(), mediaid)
+}
+
+// DownloadMediaContext 下载多媒体文件
+func (c *WXClient) DownloadMediaContext(ctx context.Context, mediaid string) (MediaObject, error) {
 	const uri = "http://file.api.weixin.qq.com/cgi-bin/media/get?access_token=%s&media_id=%s"
-	return c.downloadStuff(uri, mediaid)
+	return c.downloadStuff(ctx, uri, mediaid)
 }
 
 // DownloadHQVoice 下载高清语音文件 格式为speex，16K采样率
 func (c *WXClient) DownloadHQVoice(mediaid string) (MediaObject, error) {
+	return c.DownloadHQVoiceContext(context.Background(), mediaid)
+}
+
+// DownloadHQVoiceContext 下载高清语音文件 格式为speex，16K采样率
+func (c *WXClient) DownloadHQVoiceContext(ctx context.Context, mediaid string) (MediaObject, error) {
 	const uri = "https://api.weixin.qq.com/cgi-bin/media/get/jssdk?access_token=%s&media_id=%s"
-	return c.downloadStuff(uri, mediaid)
+	return c.downloadStuff(ctx, uri, mediaid)
 }
 
 // DownloadVideo 下载视频文件,返回视频链接
 func (c *WXClient) DownloadVideo(mediaid string) (string, error) {
+	return c.DownloadVideoContext(context.Background(), mediaid)
+}
+
+// DownloadVideoContext 下载视频文件,返回视频链接
+func (c *WXClient) DownloadVideoContext(ctx context.Context, mediaid string) (string, error) {
 	const uri = "http://file.api.weixin.qq.com/cgi-bin/media/get?access_token=%s&media_id=%s"
-	token, err := c.getAccessToken()
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -155,12 +159,12 @@ func (c *WXClient) DownloadVideo(mediaid string) (string, error) {
 		ErrMsg   string `json:"errmsg"`
 		VideoURL string `json:"video_url"`
 	}
-	err = c.httpGet(fmt.Sprintf(uri, token, mediaid), &result)
+	err = c.httpGet(ctx, fmt.Sprintf(uri, token, mediaid), &result)
 	if err != nil {
 		return result.VideoURL, err
 	}
 	if result.ErrCode != 0 {
-		return result.VideoURL, fmt.Errorf("%d-%s", result.ErrCode, result.ErrMsg)
+		return result.VideoURL, NewAPIError(result.ErrCode, result.ErrMsg)
 	}
 	return result.VideoURL, nil
 }
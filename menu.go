@@ -3,6 +3,7 @@
 package wxdev
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -151,8 +152,13 @@ func NewButtonMiniApp(name, appid, pagepath, uri string) Button {
 
 // CreateMenu 创建菜单
 func (c *WXClient) CreateMenu(items ...Button) error {
+	return c.CreateMenuContext(context.Background(), items...)
+}
+
+// CreateMenuContext 创建菜单
+func (c *WXClient) CreateMenuContext(ctx context.Context, items ...Button) error {
 	const uri = "https://api.weixin.qq.com/cgi-bin/menu/create?access_token=%s"
-	token, err := c.getAccessToken()
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return err
 	}
@@ -163,20 +169,25 @@ func (c *WXClient) CreateMenu(items ...Button) error {
 		ErrCode int    `json:"errcode"`
 		ErrMsg  string `json:"errmsg"`
 	}
-	err = c.httpPost(fmt.Sprintf(uri, token), data, &result)
+	err = c.httpPost(ctx, fmt.Sprintf(uri, token), data, &result)
 	if err != nil {
 		return err
 	}
 	if result.ErrCode != 0 {
-		return fmt.Errorf("%d-%s", result.ErrCode, result.ErrMsg)
+		return NewAPIError(result.ErrCode, result.ErrMsg)
 	}
 	return nil
 }
 
 // ClearMenu 清空菜单
 func (c *WXClient) ClearMenu() error {
+	return c.ClearMenuContext(context.Background())
+}
+
+// ClearMenuContext 清空菜单
+func (c *WXClient) ClearMenuContext(ctx context.Context) error {
 	const uri = "https://api.weixin.qq.com/cgi-bin/menu/delete?access_token=%s"
-	token, err := c.getAccessToken()
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return err
 	}
@@ -184,12 +195,12 @@ func (c *WXClient) ClearMenu() error {
 		ErrCode int    `json:"errcode"`
 		ErrMsg  string `json:"errmsg"`
 	}
-	err = c.httpGet(fmt.Sprintf(uri, token), &result)
+	err = c.httpGet(ctx, fmt.Sprintf(uri, token), &result)
 	if err != nil {
 		return err
 	}
 	if result.ErrCode != 0 {
-		return fmt.Errorf("%d-%s", result.ErrCode, result.ErrMsg)
+		return NewAPIError(result.ErrCode, result.ErrMsg)
 	}
 	return nil
 }
@@ -252,26 +263,50 @@ func (m MatchRule) validate() error {
 
 // CreatePersonalMenu 创建个性化菜单
 func (c *WXClient) CreatePersonalMenu(rule MatchRule, items ...Button) (string, error) {
+	return c.CreatePersonalMenuContext(context.Background(), rule, items...)
+}
+
+// CreatePersonalMenuContext 创建个性化菜单
+func (c *WXClient) CreatePersonalMenuContext(ctx context.Context, rule MatchRule, items ...Button) (string, error) {
 	if err := rule.validate(); err != nil {
 		return "", err
 	}
-	token, _ := c.getAccessToken()
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return "", err
+	}
 	const uri = "https://api.weixin.qq.com/cgi-bin/menu/addconditional?access_token=%s"
 	var result struct {
-		MenuID string `json:"menuid"`
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+		MenuID  string `json:"menuid"`
 	}
 	var data = struct {
 		Buttons []Button  `json:"button"`
 		Rule    MatchRule `json:"matchrule"`
 	}{items, rule}
-	err := c.httpPost(fmt.Sprintf(uri, token), data, &result)
-	return result.MenuID, err
+	err = c.httpPost(ctx, fmt.Sprintf(uri, token), data, &result)
+	if err != nil {
+		return "", err
+	}
+	if result.ErrCode != 0 {
+		return "", NewAPIError(result.ErrCode, result.ErrMsg)
+	}
+	return result.MenuID, nil
 }
 
 // DeletePersonalMenu 删除个性化菜单
 func (c *WXClient) DeletePersonalMenu(menuid string) error {
+	return c.DeletePersonalMenuContext(context.Background(), menuid)
+}
+
+// DeletePersonalMenuContext 删除个性化菜单
+func (c *WXClient) DeletePersonalMenuContext(ctx context.Context, menuid string) error {
 	const uri = "https://api.weixin.qq.com/cgi-bin/menu/delconditional?access_token=%s"
-	token, _ := c.getAccessToken()
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return err
+	}
 	var data = struct {
 		MenuID string `json:"menuid"`
 	}{menuid}
@@ -279,12 +314,12 @@ func (c *WXClient) DeletePersonalMenu(menuid string) error {
 		ErrCode int    `json:"errcode"`
 		ErrMsg  string `json:"errmsg"`
 	}
-	err := c.httpPost(fmt.Sprintf(uri, token), data, &result)
+	err = c.httpPost(ctx, fmt.Sprintf(uri, token), data, &result)
 	if err != nil {
 		return err
 	}
 	if result.ErrCode != 0 {
-		return fmt.Errorf("%d-%s", result.ErrCode, result.ErrMsg)
+		return NewAPIError(result.ErrCode, result.ErrMsg)
 	}
 	return nil
 }
@@ -292,8 +327,16 @@ func (c *WXClient) DeletePersonalMenu(menuid string) error {
 // TestPersonalMenu 测试个性化菜单
 // wxuserid 可以是粉丝的OpenID，也可以是粉丝的微信号
 func (c *WXClient) TestPersonalMenu(wxuserid string) ([]Button, error) {
+	return c.TestPersonalMenuContext(context.Background(), wxuserid)
+}
+
+// TestPersonalMenuContext 测试个性化菜单
+func (c *WXClient) TestPersonalMenuContext(ctx context.Context, wxuserid string) ([]Button, error) {
 	const uri = "https://api.weixin.qq.com/cgi-bin/menu/trymatch?access_token=%s"
-	token, _ := c.getAccessToken()
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
 	var data = struct {
 		UserID string `json:"user_id"`
 	}{wxuserid}
@@ -302,12 +345,12 @@ func (c *WXClient) TestPersonalMenu(wxuserid string) ([]Button, error) {
 		ErrMsg  string   `json:"errmsg"`
 		Buttons []Button `json:"button"`
 	}
-	err := c.httpPost(fmt.Sprintf(uri, token), data, &result)
+	err = c.httpPost(ctx, fmt.Sprintf(uri, token), data, &result)
 	if err != nil {
 		return nil, err
 	}
 	if result.ErrCode != 0 {
-		return nil, fmt.Errorf("%d-%s", result.ErrCode, result.ErrMsg)
+		return nil, NewAPIError(result.ErrCode, result.ErrMsg)
 	}
 	return result.Buttons, nil
 }
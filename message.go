@@ -3,18 +3,18 @@
 package wxdev
 
 import (
-	"crypto/sha1"
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
-	"sort"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shengzhi/wxdev/crypt"
 )
 
 // WXEventType 事件类型
@@ -64,23 +64,15 @@ type WXMessageResponse interface{}
 // WXMessageOKResponse 返回success
 type WXMessageOKResponse struct{}
 
-func (c *WXClient) validateSign(nonce, timestamp, expectSign string) bool {
-	params := []string{c.validationToken, nonce, timestamp}
-	sort.Strings(params)
-	s1 := sha1.New()
-	io.WriteString(s1, strings.Join(params, ""))
-	actualSign := fmt.Sprintf("%x", s1.Sum(nil))
-	return actualSign == expectSign
+// envelope 消息推送的签名校验及安全模式加解密
+func (c *WXClient) envelope() crypt.MsgEnvelope {
+	return crypt.MsgEnvelope{Token: c.validationToken, AppID: c.appid, AESKey: c.aesKey}
 }
 
 // CheckSignature 微信接入验证
 func (c *WXClient) CheckSignature(qryArgs url.Values) (string, error) {
-	nonce := qryArgs.Get("nonce")
-	timestamp := qryArgs.Get("timestamp")
-	expectSign := qryArgs.Get("signature")
-	echostr := qryArgs.Get("echostr")
-	if c.validateSign(nonce, timestamp, expectSign) {
-		return echostr, nil
+	if c.envelope().VerifySignature(qryArgs) {
+		return qryArgs.Get("echostr"), nil
 	}
 	return "", fmt.Errorf("微信接入验证失败")
 }
@@ -108,9 +100,27 @@ func (c *WXClient) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-	d := xml.NewDecoder(r.Body)
+	envelope := c.envelope()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Println("Read wechat message request failed,error:", err)
+		fmt.Fprintf(w, "success")
+		w.WriteHeader(200)
+		return
+	}
+	if body, err = envelope.Open(r.URL.Query(), body); err != nil {
+		if errors.Is(err, crypt.ErrInvalidSignature) || errors.Is(err, crypt.ErrEncryptRequired) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+		log.Println("Decrypt wechat message request failed,error:", err)
+		fmt.Fprintf(w, "success")
+		w.WriteHeader(200)
+		return
+	}
 	var msgReq WXMessageRequest
-	if err := d.Decode(&msgReq); err != nil {
+	if err := xml.Unmarshal(body, &msgReq); err != nil {
 		log.Println("Decode wechat message request failed,error:", err)
 		fmt.Fprintf(w, "success")
 		w.WriteHeader(200)
@@ -121,18 +131,81 @@ func (c *WXClient) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(200)
 		return
 	}
-	resp := c.msgHandler(msgReq)
-	if _, ok := resp.(WXMessageOKResponse); ok {
+	// 微信重试推送的重复消息直接回复success
+	if c.dedupStore != nil && !c.dedupStore.Add(msgReq.DedupKey(), c.dedupTTL) {
+		fmt.Fprintf(w, "success")
+		w.WriteHeader(200)
+		return
+	}
+	// 异步模式下立即回复success, 处理结果通过客服消息下发
+	if c.async != nil && c.dispatchAsync(msgReq) {
+		fmt.Fprintf(w, "success")
+		w.WriteHeader(200)
+		return
+	}
+	resp := c.callHandler(msgReq)
+	if _, ok := resp.(WXMessageOKResponse); ok || resp == nil {
 		fmt.Fprintf(w, "success")
 		w.WriteHeader(200)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	if envelope.Encrypted() {
+		reply, err := encryptMsgReply(envelope, resp)
+		if err != nil {
+			log.Println("Encrypt wechat message reply failed,error:", err)
+			fmt.Fprintf(w, "success")
+			return
+		}
+		xml.NewEncoder(w).Encode(reply)
+		w.WriteHeader(200)
+		return
+	}
 	xml.NewEncoder(w).Encode(resp)
 	w.WriteHeader(200)
 }
 
+// callHandler 同步调用消息处理器, 处理器panic时撤销排重记录, 使微信的重试推送能够再次处理
+func (c *WXClient) callHandler(req WXMessageRequest) WXMessageResponse {
+	if c.dedupStore != nil {
+		defer func() {
+			if err := recover(); err != nil {
+				c.dedupStore.Remove(req.DedupKey())
+				panic(err)
+			}
+		}()
+	}
+	return c.msgHandler(req)
+}
+
+// wxEncryptedReply 安全模式下的加密回复
+type wxEncryptedReply struct {
+	XMLName      xml.Name `xml:"xml"`
+	Encrypt      CDataContent
+	MsgSignature CDataContent
+	TimeStamp    int64
+	Nonce        CDataContent
+}
+
+// encryptMsgReply 加密回复消息
+func encryptMsgReply(envelope crypt.MsgEnvelope, resp WXMessageResponse) (wxEncryptedReply, error) {
+	plain, err := xml.Marshal(resp)
+	if err != nil {
+		return wxEncryptedReply{}, err
+	}
+	msg, err := envelope.Seal(plain)
+	if err != nil {
+		return wxEncryptedReply{}, err
+	}
+	return wxEncryptedReply{
+		Encrypt:      CDataWrap(msg.Encrypt),
+		MsgSignature: CDataWrap(msg.MsgSignature),
+		TimeStamp:    msg.TimeStamp,
+		Nonce:        CDataWrap(msg.Nonce),
+	}, nil
+}
+
 // WXMessageRequest 微信消息
 type WXMessageRequest struct {
 	XMLName                            xml.Name      `xml:"xml"`
@@ -160,6 +233,16 @@ type WXMessageRequest struct {
 	Latitude, Longitude, Precision     float64       `xml:",omitempty"`
 	ScanCodeInfo, ScanType, ScanResult string        `xml:",omitempty"`
 	SendPicsInfo                       PicInfo       `xml:",omitempty"`
+	MsgID                              int64         `xml:",omitempty"` // 模板消息及群发消息ID
+	Status                             string        `xml:",omitempty"` // 模板消息、群发及券点订单状态
+	MenuId                             string        `xml:",omitempty"` // 跳转小程序的菜单ID
+	MassSendEventInfo
+	SubscribeMsgPopupEvent  *SubscribeMsgPopupEvent  `xml:",omitempty"`
+	SubscribeMsgChangeEvent *SubscribeMsgChangeEvent `xml:",omitempty"`
+	SubscribeMsgSentEvent   *SubscribeMsgSentEvent   `xml:",omitempty"`
+	PublishEventInfo        *PublishEventInfo        `xml:",omitempty"`
+	CardEventInfo
+	VerifyEventInfo
 }
 
 // PicInfo 发送的图片信息
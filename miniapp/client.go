@@ -4,17 +4,19 @@ package miniapp
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
 	"time"
 
 	"github.com/golang/groupcache/singleflight"
 	"github.com/shengzhi/wxdev/crypt"
+	"github.com/shengzhi/wxdev/internal/wxhttp"
+	"github.com/shengzhi/wxdev/tokenserver"
+	"github.com/shengzhi/wxdev/wxerr"
 )
 
 // OptionFunc 配置函数
@@ -29,24 +31,31 @@ type option struct {
 type WXMiniClient struct {
 	opt            option
 	tokenServerURL *url.URL
-	flightG        singleflight.Group
-	httpcli        *http.Client
-	isdebug        bool
+	// tokenClientID, tokenClientSecret 访问Token server的鉴权信息
+	tokenClientID, tokenClientSecret string
+	flightG                          singleflight.Group
+	api                              wxhttp.Client
+	// msgToken, aesKey 消息推送的令牌及加解密密钥
+	msgToken       string
+	aesKey         []byte
+	msgHandlers    map[MsgType]MessageHandler
+	evtHandlers    map[EventType]MessageHandler
+	defaultHandler MessageHandler
 }
 
 // NewClient 创建客户端
 func NewClient(appid, secret string, options ...OptionFunc) *WXMiniClient {
 	c := &WXMiniClient{
-		httpcli: &http.Client{
-			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
-		},
 		opt: option{
 			appid: appid, appsecret: secret,
 		},
 	}
+	c.api.HTTPClient = &http.Client{}
 	for _, fn := range options {
 		fn(c)
 	}
+	c.api.Refresh = c.refreshAccessToken
+	c.api.SignRequest = c.signTokenRequest
 	return c
 }
 
@@ -69,80 +78,47 @@ type reply struct {
 	ErrMsg  string `json:"errmsg"`
 }
 
+// Error 返回 *APIError, errcode为0时返回nil
 func (rep reply) Error() error {
 	if rep.ErrCode == 0 {
 		return nil
 	}
-	return fmt.Errorf("code:%d,errmsg:%s", rep.ErrCode, rep.ErrMsg)
+	return wxerr.NewAPIError(rep.ErrCode, rep.ErrMsg)
 }
 
-func (c *WXMiniClient) dumpRequest(req *http.Request) {
-	if c.isdebug {
-		data, _ := httputil.DumpRequest(req, true)
-		fmt.Println(string(data))
-	}
-}
-func (c *WXMiniClient) dumpResponse(resp *http.Response) {
-	if c.isdebug {
-		data, _ := httputil.DumpResponse(resp, true)
-		fmt.Println(string(data))
-	}
-}
-
-func (c *WXMiniClient) httpDo(req *http.Request) (*http.Response, error) {
-	c.dumpRequest(req)
-	resp, err := c.httpcli.Do(req)
-	if resp != nil {
-		c.dumpResponse(resp)
-	}
-	return resp, err
+func (c *WXMiniClient) httpGet(ctx context.Context, uri string, v interface{}) error {
+	return c.callAPI(ctx, "GET", uri, nil, "", v)
 }
 
-func (c *WXMiniClient) httpGet(uri string, v interface{}) error {
-	req, err := http.NewRequest("GET", uri, nil)
-	if err != nil {
-		return err
-	}
-	res, err := c.httpDo(req)
-	if res != nil {
-		defer res.Body.Close()
-	}
-	if err != nil {
-		return err
-	}
-	return json.NewDecoder(res.Body).Decode(v)
-}
-
-func (c *WXMiniClient) httpPost(uri string, data, v interface{}) error {
+func (c *WXMiniClient) httpPost(ctx context.Context, uri string, data, v interface{}) error {
 	var buf bytes.Buffer
 	coder := json.NewEncoder(&buf)
 	coder.SetEscapeHTML(false)
 	if err := coder.Encode(data); err != nil {
 		return err
 	}
-	req, err := http.NewRequest("POST", uri, &buf)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	res, err := c.httpDo(req)
-	if res != nil {
-		defer res.Body.Close()
-	}
-	if err != nil {
-		return err
-	}
-	return json.NewDecoder(res.Body).Decode(v)
+	return c.callAPI(ctx, "POST", uri, buf.Bytes(), "application/json", v)
+}
+
+// callAPI 调用接口并解析JSON结果, access_token失效时强制刷新并重试一次
+func (c *WXMiniClient) callAPI(ctx context.Context, method, uri string, body []byte, contentType string, v interface{}) error {
+	return c.api.Call(ctx, method, uri, body, contentType, v)
 }
-func (c *WXMiniClient) EnableDebug() { c.isdebug = true }
+
+func (c *WXMiniClient) EnableDebug() { c.api.Debug = true }
 
 // GetSessionKey 获取小程序session key
 func (c *WXMiniClient) GetSessionKey(code string) (WXAppSession, error) {
+	return c.GetSessionKeyContext(context.Background(), code)
+}
+
+// GetSessionKeyContext 获取小程序session key
+func (c *WXMiniClient) GetSessionKeyContext(ctx context.Context, code string) (WXAppSession, error) {
 	uri := fmt.Sprintf(sessionkey_url, c.opt.appid, c.opt.appsecret, code)
 	var s WXAppSession
-	err := c.httpGet(uri, &s)
-	if s.ErrCode != 0 {
-		err = fmt.Errorf("%d-%s", s.ErrCode, s.ErrMsg)
+	err := c.httpGet(ctx, uri, &s)
+	if err == nil && s.ErrCode != 0 {
+		err = wxerr.NewAPIError(s.ErrCode, s.ErrMsg)
 	}
 	return s, err
 }
@@ -163,31 +139,72 @@ func (c *WXMiniClient) WXAppDecript(crypted, sessionkey, iv string) ([]byte, err
 	return crypt.AESDecrypt(cryptedByte, key, ivbyte)
 }
 
-func (c *WXMiniClient) getAccessToken() (string, error) {
-	var err error
-	var token string
+func (c *WXMiniClient) getAccessToken(ctx context.Context) (string, error) {
 	u, err := url.Parse(fmt.Sprintf("token?appid=%s", c.opt.appid))
 	if err != nil {
 		return "", err
 	}
 	tokenUri := c.tokenServerURL.ResolveReference(u).String()
+	var resp interface{}
 	for i := 0; i < 5; i++ {
-		resp, err := c.flightG.Do("getaccesstoken", func() (interface{}, error) {
+		resp, err = c.flightG.Do("getaccesstoken", func() (interface{}, error) {
 			var reply struct{ Token string }
-			err := c.httpGet(tokenUri, &reply)
+			err := c.tokenServerGet(ctx, tokenUri, &reply)
+			if err == nil && reply.Token == "" {
+				err = ErrEmptyToken
+			}
 			return reply.Token, err
 		})
-		if err != nil {
-			if c.isdebug {
-				fmt.Printf("get access_token error:%v,url:%s", err, tokenUri)
-			}
-			time.Sleep(time.Second)
-			continue
+		if err == nil {
+			return resp.(string), nil
+		}
+		// 微信返回的错误(如IP不在白名单)重试无意义
+		if ErrCode(err) != 0 {
+			return "", err
+		}
+		if c.api.Debug {
+			fmt.Printf("get access_token error:%v,url:%s", err, tokenUri)
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Second):
 		}
-		token = resp.(string)
-		break
 	}
-	return token, err
+	return "", err
+}
+
+// refreshAccessToken 通知Token server强制刷新access_token, stale为已失效的token
+func (c *WXMiniClient) refreshAccessToken(ctx context.Context, stale string) (string, error) {
+	u, err := url.Parse(fmt.Sprintf("token?appid=%s&refresh=1&stale=%s", c.opt.appid, url.QueryEscape(stale)))
+	if err != nil {
+		return "", err
+	}
+	tokenUri := c.tokenServerURL.ResolveReference(u).String()
+	resp, err := c.flightG.Do("refreshaccesstoken", func() (interface{}, error) {
+		var reply struct{ Token string }
+		err := c.tokenServerGet(ctx, tokenUri, &reply)
+		if err == nil && reply.Token == "" {
+			err = ErrEmptyToken
+		}
+		return reply.Token, err
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.(string), nil
+}
+
+// tokenServerGet 请求Token server
+func (c *WXMiniClient) tokenServerGet(ctx context.Context, uri string, v interface{}) error {
+	return c.api.TokenServerGet(ctx, uri, v)
+}
+
+// signTokenRequest 配置了鉴权信息时对Token server请求签名
+func (c *WXMiniClient) signTokenRequest(req *http.Request) {
+	if c.tokenClientID != "" {
+		tokenserver.SignRequest(req, c.tokenClientID, c.tokenClientSecret)
+	}
 }
 
 type WXSexType byte
@@ -253,8 +270,14 @@ func (c *WXMiniClient) DecryptPhoneNumber(iv, cipherTxt, sessionKey string) (WXP
 	return phone, err
 }
 
+// GetPhoneNumber 通过手机号快速验证组件返回的code获取绑定电话号码.
 func (c *WXMiniClient) GetPhoneNumber(code string) (WXPhoneInfo, error) {
-	token, err := c.getAccessToken()
+	return c.GetPhoneNumberContext(context.Background(), code)
+}
+
+// GetPhoneNumberContext 通过手机号快速验证组件返回的code获取绑定电话号码.
+func (c *WXMiniClient) GetPhoneNumberContext(ctx context.Context, code string) (WXPhoneInfo, error) {
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return WXPhoneInfo{}, err
 	}
@@ -263,7 +286,7 @@ func (c *WXMiniClient) GetPhoneNumber(code string) (WXPhoneInfo, error) {
 		PhoneInfo WXPhoneInfo `json:"phone_info"`
 	}
 	req := map[string]string{"code": code}
-	err = c.httpPost(url_getPhoneNumber.Format(token), req, &resp)
+	err = c.httpPost(ctx, url_getPhoneNumber.Format(token), req, &resp)
 	if err != nil {
 		return WXPhoneInfo{}, err
 	}
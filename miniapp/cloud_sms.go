@@ -1,6 +1,8 @@
 // 云开发-短信.
 package miniapp
 
+import "context"
+
 type (
 	SMSSendReq struct {
 		// Env 云开发环境ID.
@@ -31,7 +33,12 @@ type (
 
 // SendSMS 发送携带 URL Link 的短信.
 func (c *WXMiniClient) SendSMS(req SMSSendReq) (SMSSendResp, error) {
-	token, err := c.getAccessToken()
+	return c.SendSMSContext(context.Background(), req)
+}
+
+// SendSMSContext 发送携带 URL Link 的短信.
+func (c *WXMiniClient) SendSMSContext(ctx context.Context, req SMSSendReq) (SMSSendResp, error) {
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return SMSSendResp{}, err
 	}
@@ -40,7 +47,7 @@ func (c *WXMiniClient) SendSMS(req SMSSendReq) (SMSSendResp, error) {
 		reply
 		SMSSendResp
 	}
-	err = c.httpPost(uri, req, &resp)
+	err = c.httpPost(ctx, uri, req, &resp)
 	if err != nil {
 		return resp.SMSSendResp, err
 	}
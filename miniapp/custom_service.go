@@ -0,0 +1,189 @@
+// 小程序客服消息
+
+package miniapp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+)
+
+// CustomerMessage 客服消息
+type CustomerMessage struct {
+	fields map[string]interface{}
+}
+
+// NewCustomerMessage 创建客服消息, to 为用户openid
+func NewCustomerMessage(to string) CustomerMessage {
+	msg := CustomerMessage{
+		fields: make(map[string]interface{}),
+	}
+	msg.fields["touser"] = to
+	return msg
+}
+
+// WithText 文本消息
+func (msg CustomerMessage) WithText(content string) CustomerMessage {
+	msg.fields["msgtype"] = "text"
+	msg.fields["text"] = struct {
+		Content string `json:"content"`
+	}{content}
+	return msg
+}
+
+// WithImage 图片消息
+func (msg CustomerMessage) WithImage(mediaid string) CustomerMessage {
+	msg.fields["msgtype"] = "image"
+	msg.fields["image"] = struct {
+		MediaID string `json:"media_id"`
+	}{mediaid}
+	return msg
+}
+
+// WithLink 图文链接
+func (msg CustomerMessage) WithLink(title, desc, uri, thumbURL string) CustomerMessage {
+	msg.fields["msgtype"] = "link"
+	msg.fields["link"] = struct {
+		Title    string `json:"title"`
+		Desc     string `json:"description"`
+		URL      string `json:"url"`
+		ThumbURL string `json:"thumb_url"`
+	}{title, desc, uri, thumbURL}
+	return msg
+}
+
+// WithMiniProgramPage 小程序卡片, thumbMediaid 为通过 UploadTempMedia 上传的封面图片
+func (msg CustomerMessage) WithMiniProgramPage(title, pagepath, thumbMediaid string) CustomerMessage {
+	msg.fields["msgtype"] = "miniprogrampage"
+	msg.fields["miniprogrampage"] = struct {
+		Title        string `json:"title"`
+		PagePath     string `json:"pagepath"`
+		ThumbMediaID string `json:"thumb_media_id"`
+	}{title, pagepath, thumbMediaid}
+	return msg
+}
+
+// SendCustomerMessage 发送客服消息
+func (c *WXMiniClient) SendCustomerMessage(msg CustomerMessage) error {
+	return c.SendCustomerMessageContext(context.Background(), msg)
+}
+
+// SendCustomerMessageContext 发送客服消息
+func (c *WXMiniClient) SendCustomerMessageContext(ctx context.Context, msg CustomerMessage) error {
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	var resp reply
+	if err = c.httpPost(ctx, url_custom_send.Format(token), msg.fields, &resp); err != nil {
+		return err
+	}
+	return resp.Error()
+}
+
+// SetTyping 下发或取消客服输入状态
+func (c *WXMiniClient) SetTyping(openid string, typing bool) error {
+	return c.SetTypingContext(context.Background(), openid, typing)
+}
+
+// SetTypingContext 下发或取消客服输入状态
+func (c *WXMiniClient) SetTypingContext(ctx context.Context, openid string, typing bool) error {
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	command := "CancelTyping"
+	if typing {
+		command = "Typing"
+	}
+	data := map[string]string{"touser": openid, "command": command}
+	var resp reply
+	if err = c.httpPost(ctx, url_custom_typing.Format(token), data, &resp); err != nil {
+		return err
+	}
+	return resp.Error()
+}
+
+// UploadTempMediaFile 上传图片至临时素材库, 返回media_id
+func (c *WXMiniClient) UploadTempMediaFile(filename string) (string, error) {
+	return c.UploadTempMediaFileContext(context.Background(), filename)
+}
+
+// UploadTempMediaFileContext 上传图片至临时素材库, 返回media_id
+func (c *WXMiniClient) UploadTempMediaFileContext(ctx context.Context, filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return c.UploadTempMediaContext(ctx, filepath.Base(filename), file)
+}
+
+// UploadTempMedia 上传图片至临时素材库, 返回media_id, 小程序客服消息仅支持图片类型
+func (c *WXMiniClient) UploadTempMedia(filename string, file io.Reader) (string, error) {
+	return c.UploadTempMediaContext(context.Background(), filename, file)
+}
+
+// UploadTempMediaContext 上传图片至临时素材库, 返回media_id
+func (c *WXMiniClient) UploadTempMediaContext(ctx context.Context, filename string, file io.Reader) (string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	fw, err := w.CreateFormFile("media", filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(fw, file); err != nil {
+		return "", err
+	}
+	if err = w.Close(); err != nil {
+		return "", err
+	}
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		reply
+		MediaID string `json:"media_id"`
+	}
+	err = c.callAPI(ctx, "POST", url_media_upload.Format(token, "image"), buf.Bytes(), w.FormDataContentType(), &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.MediaID, resp.Error()
+}
+
+// MediaObject 临时素材
+type MediaObject struct {
+	FileName string
+	Type     string
+	Data     io.ReadCloser
+	Size     int64
+}
+
+// DownloadTempMedia 下载临时素材
+func (c *WXMiniClient) DownloadTempMedia(mediaid string) (MediaObject, error) {
+	return c.DownloadTempMediaContext(context.Background(), mediaid)
+}
+
+// DownloadTempMediaContext 下载临时素材
+func (c *WXMiniClient) DownloadTempMediaContext(ctx context.Context, mediaid string) (MediaObject, error) {
+	var obj MediaObject
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return obj, err
+	}
+	resp, err := c.api.Download(ctx, "GET", url_media_get.Format(token, mediaid), nil, "")
+	if err != nil {
+		return obj, err
+	}
+	obj.Type = resp.Header.Get("Content-Type")
+	obj.Data = ioutil.NopCloser(bytes.NewReader(resp.Body))
+	obj.Size = int64(len(resp.Body))
+	obj.FileName = resp.FileName()
+	return obj, nil
+}
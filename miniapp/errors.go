@@ -0,0 +1,27 @@
+// 微信接口错误
+
+package miniapp
+
+import (
+	"errors"
+
+	"github.com/shengzhi/wxdev/wxerr"
+)
+
+// ErrEmptyToken Token server 未返回access_token
+var ErrEmptyToken = errors.New("Token server returned empty access_token")
+
+// APIError 微信接口返回的错误, 与 wxerr.APIError 为同一类型
+type APIError = wxerr.APIError
+
+// ErrCode 返回err中的微信错误码, 非APIError时返回0
+func ErrCode(err error) int { return wxerr.ErrCode(err) }
+
+// IsTokenExpired access_token是否无效或已过期
+func IsTokenExpired(err error) bool { return wxerr.IsTokenExpired(err) }
+
+// IsRateLimited 是否触发接口调用频率或次数限制
+func IsRateLimited(err error) bool { return wxerr.IsRateLimited(err) }
+
+// IsUserRefused 用户是否拒绝接受消息
+func IsUserRefused(err error) bool { return wxerr.IsUserRefused(err) }
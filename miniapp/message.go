@@ -0,0 +1,364 @@
+// 小程序消息推送
+
+package miniapp
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shengzhi/wxdev/crypt"
+)
+
+// MsgType 消息类型
+type MsgType string
+
+// 消息类型定义
+const (
+	MsgTypeText            MsgType = "text"
+	MsgTypeImage           MsgType = "image"
+	MsgTypeMiniProgramPage MsgType = "miniprogrampage"
+	MsgTypeEvent           MsgType = "event"
+	MsgTypeTransferCS      MsgType = "transfer_customer_service"
+)
+
+// EventType 事件类型
+type EventType string
+
+// 事件类型定义
+const (
+	// 用户进入客服会话
+	EventTypeUserEnterTempSession EventType = "user_enter_tempsession"
+	// 音视频内容安全异步检测结果
+	EventTypeMediaCheck EventType = "wxa_media_check"
+	// 订阅消息
+	EventTypeSubscribeMsgPopup  EventType = "subscribe_msg_popup_event"
+	EventTypeSubscribeMsgChange EventType = "subscribe_msg_change_event"
+	EventTypeSubscribeMsgSent   EventType = "subscribe_msg_sent_event"
+)
+
+// MediaCheckResult 内容安全检测综合结果, suggest 为 risky/pass/review
+type MediaCheckResult struct {
+	Suggest string `xml:"suggest" json:"suggest"`
+	Label   int    `xml:"label" json:"label"`
+}
+
+// MediaCheckDetail 内容安全检测详细结果
+type MediaCheckDetail struct {
+	Strategy string `xml:"strategy" json:"strategy"`
+	ErrCode  int    `xml:"errcode" json:"errcode"`
+	Suggest  string `xml:"suggest" json:"suggest"`
+	Label    int    `xml:"label" json:"label"`
+	Prob     int    `xml:"prob" json:"prob"`
+}
+
+// SubscribeMsgPopupItem 用户在订阅消息弹框中的操作
+type SubscribeMsgPopupItem struct {
+	TemplateId            string `xml:",omitempty" json:",omitempty"`
+	SubscribeStatusString string `xml:",omitempty" json:",omitempty"`
+	PopupScene            int    `xml:",omitempty" json:",omitempty"` // 2:小程序内
+}
+
+// SubscribeMsgChangeItem 用户在设置页面的订阅变更
+type SubscribeMsgChangeItem struct {
+	TemplateId            string `xml:",omitempty" json:",omitempty"`
+	SubscribeStatusString string `xml:",omitempty" json:",omitempty"`
+}
+
+// SubscribeMsgSentItem 订阅消息发送结果
+type SubscribeMsgSentItem struct {
+	TemplateId  string `xml:",omitempty" json:",omitempty"`
+	MsgID       string `xml:",omitempty" json:",omitempty"`
+	ErrorCode   int    `xml:",omitempty" json:",omitempty"`
+	ErrorStatus string `xml:",omitempty" json:",omitempty"`
+}
+
+// SubscribeMsgPopupEvent 订阅消息弹框事件
+type SubscribeMsgPopupEvent struct {
+	List []SubscribeMsgPopupItem `xml:",omitempty" json:",omitempty"`
+}
+
+// SubscribeMsgChangeEvent 订阅消息变更事件
+type SubscribeMsgChangeEvent struct {
+	List []SubscribeMsgChangeItem `xml:",omitempty" json:",omitempty"`
+}
+
+// SubscribeMsgSentEvent 订阅消息发送结果事件
+type SubscribeMsgSentEvent struct {
+	List []SubscribeMsgSentItem `xml:",omitempty" json:",omitempty"`
+}
+
+// Message 小程序推送的消息及事件
+type Message struct {
+	XMLName      xml.Name  `xml:"xml" json:"-"`
+	ToUserName   string    `xml:",omitempty" json:",omitempty"`
+	FromUserName string    `xml:",omitempty" json:",omitempty"`
+	CreateTime   int64     `xml:",omitempty" json:",omitempty"`
+	MsgType      MsgType   `xml:",omitempty" json:",omitempty"`
+	Event        EventType `xml:",omitempty" json:",omitempty"`
+	MsgId        int64     `xml:",omitempty" json:",omitempty"`
+	// 文本消息
+	Content string `xml:",omitempty" json:",omitempty"`
+	// 图片消息
+	PicUrl  string `xml:",omitempty" json:",omitempty"`
+	MediaId string `xml:",omitempty" json:",omitempty"`
+	// 小程序卡片消息
+	Title        string `xml:",omitempty" json:",omitempty"`
+	AppID        string `xml:"AppId,omitempty" json:"appid,omitempty"` // 内容安全检测结果事件中同样有效
+	PagePath     string `xml:",omitempty" json:",omitempty"`
+	ThumbUrl     string `xml:",omitempty" json:",omitempty"`
+	ThumbMediaId string `xml:",omitempty" json:",omitempty"`
+	// 进入客服会话事件
+	SessionFrom string `xml:",omitempty" json:",omitempty"`
+	// 内容安全检测结果事件, 各检测策略的错误码位于Detail
+	TraceID string             `xml:"trace_id,omitempty" json:"trace_id,omitempty"`
+	Version int                `xml:"version,omitempty" json:"version,omitempty"`
+	Detail  []MediaCheckDetail `xml:"detail,omitempty" json:"detail,omitempty"`
+	Result  *MediaCheckResult  `xml:"result,omitempty" json:"result,omitempty"`
+	// 订阅消息事件
+	SubscribeMsgPopupEvent  *SubscribeMsgPopupEvent  `xml:",omitempty" json:",omitempty"`
+	SubscribeMsgChangeEvent *SubscribeMsgChangeEvent `xml:",omitempty" json:",omitempty"`
+	SubscribeMsgSentEvent   *SubscribeMsgSentEvent   `xml:",omitempty" json:",omitempty"`
+}
+
+// IsEvent 是否为事件推送
+func (m Message) IsEvent() bool { return m.MsgType == MsgTypeEvent }
+
+// jsonMessage JSON格式推送中数值可能以字符串表示, 订阅消息事件的列表位于顶层List字段
+type jsonMessage struct {
+	Message
+	CreateTime json.Number     `json:",omitempty"`
+	MsgId      json.Number     `json:",omitempty"`
+	List       json.RawMessage `json:",omitempty"`
+}
+
+type jsonSubscribeItem struct {
+	TemplateId            string
+	SubscribeStatusString string
+	PopupScene            json.Number
+	MsgID                 string
+	ErrorCode             json.Number
+	ErrorStatus           string
+}
+
+// decodeXMLMessage 解析XML格式的推送, 小程序卡片消息为AppId, 内容安全检测事件为appid
+func decodeXMLMessage(data []byte) (Message, error) {
+	var xm struct {
+		Message
+		LowerAppID string `xml:"appid"`
+	}
+	if err := xml.Unmarshal(data, &xm); err != nil {
+		return Message{}, err
+	}
+	msg := xm.Message
+	if msg.AppID == "" {
+		msg.AppID = xm.LowerAppID
+	}
+	return msg, nil
+}
+
+// decodeJSONMessage 解析JSON格式的推送
+func decodeJSONMessage(data []byte) (Message, error) {
+	var jm jsonMessage
+	if err := json.Unmarshal(data, &jm); err != nil {
+		return Message{}, err
+	}
+	msg := jm.Message
+	msg.CreateTime, _ = jm.CreateTime.Int64()
+	msg.MsgId, _ = jm.MsgId.Int64()
+	if len(jm.List) == 0 {
+		return msg, nil
+	}
+	// 单条记录时List可能为对象
+	var items []jsonSubscribeItem
+	if isJSONData(jm.List) {
+		var item jsonSubscribeItem
+		if err := json.Unmarshal(jm.List, &item); err != nil {
+			return Message{}, err
+		}
+		items = append(items, item)
+	} else if err := json.Unmarshal(jm.List, &items); err != nil {
+		return Message{}, err
+	}
+	switch msg.Event {
+	case EventTypeSubscribeMsgPopup:
+		msg.SubscribeMsgPopupEvent = &SubscribeMsgPopupEvent{}
+		for _, item := range items {
+			scene, _ := item.PopupScene.Int64()
+			msg.SubscribeMsgPopupEvent.List = append(msg.SubscribeMsgPopupEvent.List, SubscribeMsgPopupItem{
+				TemplateId: item.TemplateId, SubscribeStatusString: item.SubscribeStatusString, PopupScene: int(scene),
+			})
+		}
+	case EventTypeSubscribeMsgChange:
+		msg.SubscribeMsgChangeEvent = &SubscribeMsgChangeEvent{}
+		for _, item := range items {
+			msg.SubscribeMsgChangeEvent.List = append(msg.SubscribeMsgChangeEvent.List, SubscribeMsgChangeItem{
+				TemplateId: item.TemplateId, SubscribeStatusString: item.SubscribeStatusString,
+			})
+		}
+	case EventTypeSubscribeMsgSent:
+		msg.SubscribeMsgSentEvent = &SubscribeMsgSentEvent{}
+		for _, item := range items {
+			code, _ := item.ErrorCode.Int64()
+			msg.SubscribeMsgSentEvent.List = append(msg.SubscribeMsgSentEvent.List, SubscribeMsgSentItem{
+				TemplateId: item.TemplateId, MsgID: item.MsgID, ErrorCode: int(code), ErrorStatus: item.ErrorStatus,
+			})
+		}
+	}
+	return msg, nil
+}
+
+// MessageResponse 被动回复消息, 返回nil时回复success
+type MessageResponse interface{}
+
+// MessageHandler 消息处理器
+type MessageHandler func(Message) MessageResponse
+
+// TransferCSResponse 将消息转发至客服
+type TransferCSResponse struct {
+	XMLName      xml.Name `xml:"xml" json:"-"`
+	ToUserName   string
+	FromUserName string
+	CreateTime   int64
+	MsgType      MsgType
+}
+
+// TransferCustomerService 创建转发客服的回复
+func TransferCustomerService(msg Message) TransferCSResponse {
+	return TransferCSResponse{
+		ToUserName:   msg.FromUserName,
+		FromUserName: msg.ToUserName,
+		CreateTime:   time.Now().Unix(),
+		MsgType:      MsgTypeTransferCS,
+	}
+}
+
+// HandleMessage 按消息类型注册处理器
+func (c *WXMiniClient) HandleMessage(t MsgType, handler MessageHandler) {
+	if c.msgHandlers == nil {
+		c.msgHandlers = make(map[MsgType]MessageHandler)
+	}
+	c.msgHandlers[t] = handler
+}
+
+// HandleEvent 按事件类型注册处理器
+func (c *WXMiniClient) HandleEvent(e EventType, handler MessageHandler) {
+	if c.evtHandlers == nil {
+		c.evtHandlers = make(map[EventType]MessageHandler)
+	}
+	c.evtHandlers[e] = handler
+}
+
+// HandleDefault 未注册处理器的消息及事件由handler处理
+func (c *WXMiniClient) HandleDefault(handler MessageHandler) {
+	c.defaultHandler = handler
+}
+
+func (c *WXMiniClient) dispatch(msg Message) MessageResponse {
+	handler := c.defaultHandler
+	if msg.IsEvent() {
+		if h, has := c.evtHandlers[msg.Event]; has {
+			handler = h
+		}
+	} else if h, has := c.msgHandlers[msg.MsgType]; has {
+		handler = h
+	}
+	if handler == nil {
+		return nil
+	}
+	return handler(msg)
+}
+
+// envelope 消息推送的签名校验及安全模式加解密
+func (c *WXMiniClient) envelope() crypt.MsgEnvelope {
+	return crypt.MsgEnvelope{Token: c.msgToken, AppID: c.opt.appid, AESKey: c.aesKey}
+}
+
+// ServeHTTP 接收小程序消息推送, 支持URL验证、XML及JSON数据格式、明文及安全模式
+func (c *WXMiniClient) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	qryArgs := r.URL.Query()
+	envelope := c.envelope()
+	if r.Method == "GET" {
+		if !envelope.VerifySignature(qryArgs) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, crypt.ErrInvalidSignature.Error())
+			return
+		}
+		fmt.Fprintf(w, "%s", qryArgs.Get("echostr"))
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Println("Read mini program message failed,error:", err)
+		fmt.Fprintf(w, "success")
+		return
+	}
+	// 回复与推送使用相同的数据格式
+	isJSON := isJSONData(body)
+	if body, err = envelope.Open(qryArgs, body); err != nil {
+		if errors.Is(err, crypt.ErrInvalidSignature) || errors.Is(err, crypt.ErrEncryptRequired) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+		log.Println("Decrypt mini program message failed,error:", err)
+		fmt.Fprintf(w, "success")
+		return
+	}
+	var msg Message
+	if isJSONData(body) {
+		msg, err = decodeJSONMessage(body)
+	} else {
+		msg, err = decodeXMLMessage(body)
+	}
+	if err != nil {
+		log.Println("Decode mini program message failed,error:", err)
+		fmt.Fprintf(w, "success")
+		return
+	}
+	resp := c.dispatch(msg)
+	if resp == nil {
+		fmt.Fprintf(w, "success")
+		return
+	}
+	if envelope.Encrypted() {
+		if resp, err = encryptReply(envelope, resp, isJSON); err != nil {
+			log.Println("Encrypt mini program reply failed,error:", err)
+			fmt.Fprintf(w, "success")
+			return
+		}
+	}
+	if isJSON {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	xml.NewEncoder(w).Encode(resp)
+}
+
+func isJSONData(data []byte) bool {
+	return strings.HasPrefix(strings.TrimSpace(string(data)), "{")
+}
+
+// encryptReply 加密回复消息
+func encryptReply(envelope crypt.MsgEnvelope, resp MessageResponse, isJSON bool) (crypt.EncryptedMsg, error) {
+	var plain []byte
+	var err error
+	if isJSON {
+		plain, err = json.Marshal(resp)
+	} else {
+		plain, err = xml.Marshal(resp)
+	}
+	if err != nil {
+		return crypt.EncryptedMsg{}, err
+	}
+	return envelope.Seal(plain)
+}
@@ -0,0 +1,138 @@
+package miniapp
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shengzhi/wxdev/crypt"
+)
+
+const (
+	testAppID  = "wxminiapp"
+	testToken  = "msg-token"
+	testAESKey = "jWmYm7qr5nMoAUwZRjGtBxmz3KA1tkAj3ykkR6q2B2C"
+)
+
+// pushQuery 生成推送请求的签名参数
+func pushQuery(token string) url.Values {
+	timestamp, nonce := strconv.FormatInt(time.Now().Unix(), 10), "nonce"
+	env := crypt.MsgEnvelope{Token: token}
+	return url.Values{"timestamp": {timestamp}, "nonce": {nonce}, "signature": {env.Signature(timestamp, nonce)}}
+}
+
+func push(c *WXMiniClient, method string, q url.Values, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/wxpush?"+q.Encode(), strings.NewReader(body))
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, req)
+	return w
+}
+
+// echoClient 回复转发客服消息并记录收到的消息
+func echoClient(options ...OptionFunc) (*WXMiniClient, *Message) {
+	var got Message
+	c := NewClient(testAppID, "secret", append([]OptionFunc{WithMessageToken(testToken)}, options...)...)
+	c.HandleDefault(func(msg Message) MessageResponse {
+		got = msg
+		return TransferCustomerService(msg)
+	})
+	return c, &got
+}
+
+func TestServeVerifyURL(t *testing.T) {
+	c, _ := echoClient()
+	q := pushQuery(testToken)
+	q.Set("echostr", "echo-123")
+	if w := push(c, "GET", q, ""); w.Code != http.StatusOK || w.Body.String() != "echo-123" {
+		t.Errorf("status = %d, body = %s, want echostr", w.Code, w.Body)
+	}
+	q.Set("signature", "forged")
+	if w := push(c, "GET", q, ""); w.Code != http.StatusForbidden {
+		t.Errorf("forged signature: status = %d, want 403", w.Code)
+	}
+}
+
+func TestServePlainXML(t *testing.T) {
+	c, got := echoClient()
+	body := `<xml><ToUserName>gh_mini</ToUserName><FromUserName>oUser</FromUserName><CreateTime>1700000000</CreateTime>` +
+		`<MsgType>event</MsgType><Event>wxa_media_check</Event><appid>wxminiapp</appid><trace_id>trace-1</trace_id>` +
+		`<result><suggest>risky</suggest><label>20002</label></result></xml>`
+	w := push(c, "POST", pushQuery(testToken), body)
+	if got.Event != EventTypeMediaCheck || got.AppID != testAppID || got.TraceID != "trace-1" || got.Result == nil || got.Result.Suggest != "risky" {
+		t.Fatalf("message = %+v", *got)
+	}
+	var reply TransferCSResponse
+	if err := xml.Unmarshal(w.Body.Bytes(), &reply); err != nil || reply.MsgType != MsgTypeTransferCS || reply.ToUserName != "oUser" {
+		t.Errorf("reply = %s, error = %v", w.Body, err)
+	}
+
+	body = `<xml><ToUserName>gh_mini</ToUserName><FromUserName>oUser</FromUserName><MsgType>miniprogrampage</MsgType>` +
+		`<MsgId>1</MsgId><AppId>wxcard</AppId><PagePath>pages/index</PagePath></xml>`
+	push(c, "POST", pushQuery(testToken), body)
+	if got.MsgType != MsgTypeMiniProgramPage || got.AppID != "wxcard" {
+		t.Errorf("card message = %+v", *got)
+	}
+}
+
+func TestServePlainJSON(t *testing.T) {
+	c, got := echoClient()
+	body := `{"ToUserName":"gh_mini","FromUserName":"oUser","CreateTime":"1700000000","MsgType":"text","Content":"hello","MsgId":"42"}`
+	w := push(c, "POST", pushQuery(testToken), body)
+	if got.MsgType != MsgTypeText || got.Content != "hello" || got.MsgId != 42 || got.CreateTime != 1700000000 {
+		t.Fatalf("message = %+v", *got)
+	}
+	var reply TransferCSResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil || reply.MsgType != MsgTypeTransferCS {
+		t.Errorf("reply = %s, error = %v", w.Body, err)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %s, want json", ct)
+	}
+}
+
+func TestServeEncryptedJSON(t *testing.T) {
+	c, got := echoClient(WithEncodingAESKey(testAESKey))
+	key, _ := crypt.DecodeAESKey(testAESKey)
+	plain := `{"ToUserName":"gh_mini","FromUserName":"oUser","CreateTime":1700000000,"MsgType":"text","Content":"secret","MsgId":7}`
+
+	// 安全模式下拒绝明文推送
+	if w := push(c, "POST", pushQuery(testToken), plain); w.Code != http.StatusForbidden || got.MsgType != "" {
+		t.Fatalf("plaintext push: status = %d, message = %+v", w.Code, *got)
+	}
+
+	encrypt, err := crypt.EncryptMsg(key, testAppID, []byte(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := pushQuery(testToken)
+	q.Set("encrypt_type", "aes")
+	q.Set("msg_signature", crypt.MsgSignature(testToken, q.Get("timestamp"), q.Get("nonce"), encrypt))
+	body, _ := json.Marshal(map[string]string{"ToUserName": "gh_mini", "Encrypt": encrypt})
+	w := push(c, "POST", q, string(body))
+	if got.Content != "secret" || got.MsgId != 7 {
+		t.Fatalf("message = %+v", *got)
+	}
+
+	var reply crypt.EncryptedMsg
+	if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil || reply.Encrypt == "" {
+		t.Fatalf("reply = %s, error = %v", w.Body, err)
+	}
+	sign := crypt.MsgSignature(testToken, strconv.FormatInt(reply.TimeStamp, 10), reply.Nonce, reply.Encrypt)
+	if reply.MsgSignature != sign {
+		t.Errorf("reply MsgSignature = %s, want %s", reply.MsgSignature, sign)
+	}
+	data, appid, err := crypt.DecryptMsg(key, reply.Encrypt)
+	if err != nil || appid != testAppID {
+		t.Fatalf("decrypt reply: appid = %s, error = %v", appid, err)
+	}
+	var resp TransferCSResponse
+	if err := json.Unmarshal(data, &resp); err != nil || resp.MsgType != MsgTypeTransferCS || resp.ToUserName != "oUser" {
+		t.Errorf("decrypted reply = %s, error = %v", data, err)
+	}
+}
@@ -1,7 +1,10 @@
 package miniapp
 
 import (
+	"net/http"
 	"net/url"
+
+	"github.com/shengzhi/wxdev/crypt"
 )
 
 // WithTokenServer 设置Token server
@@ -18,8 +21,60 @@ func WithTokenServer(uri string) OptionFunc {
 	}
 }
 
+// WithTokenServerAuth 设置访问Token server的客户端ID及签名密钥
+func WithTokenServerAuth(clientID, secret string) OptionFunc {
+	return func(c *WXMiniClient) {
+		c.tokenClientID, c.tokenClientSecret = clientID, secret
+	}
+}
+
+// WithBaseURL 将所有微信接口域名(api/file.api/mp.weixin.qq.com)替换为指定地址, 用于测试环境或模拟服务
+func WithBaseURL(uri string) OptionFunc {
+	return func(c *WXMiniClient) {
+		var err error
+		c.api.BaseURL, err = url.Parse(uri)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// WithHTTPClient 设置调用微信接口及Token server使用的HTTP客户端
+func WithHTTPClient(client *http.Client) OptionFunc {
+	return func(c *WXMiniClient) {
+		c.api.HTTPClient = client
+	}
+}
+
+// WithTransport 设置HTTP客户端的Transport, 可用于配置代理、链路追踪等
+func WithTransport(rt http.RoundTripper) OptionFunc {
+	return func(c *WXMiniClient) {
+		client := *c.api.HTTPClient
+		client.Transport = rt
+		c.api.HTTPClient = &client
+	}
+}
+
+// WithMessageToken 设置消息推送配置的令牌(Token)
+func WithMessageToken(token string) OptionFunc {
+	return func(c *WXMiniClient) {
+		c.msgToken = token
+	}
+}
+
+// WithEncodingAESKey 设置消息加解密密钥, 启用安全模式, 此后将拒绝未加密的消息推送
+func WithEncodingAESKey(encodingAESKey string) OptionFunc {
+	return func(c *WXMiniClient) {
+		var err error
+		c.aesKey, err = crypt.DecodeAESKey(encodingAESKey)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
 func WithDebug() OptionFunc {
 	return func(c *WXMiniClient) {
-		c.isdebug = true
+		c.api.Debug = true
 	}
 }
@@ -2,6 +2,7 @@
 package miniapp
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 )
@@ -29,8 +30,13 @@ type SoterResult struct {
 
 // VerifySignature 用于SOTER 生物认证秘钥签名验证.
 func (c *WXMiniClient) VerifySignature(openid, jsonstr, signature string) (SoterResult, error) {
+	return c.VerifySignatureContext(context.Background(), openid, jsonstr, signature)
+}
+
+// VerifySignatureContext 用于SOTER 生物认证秘钥签名验证.
+func (c *WXMiniClient) VerifySignatureContext(ctx context.Context, openid, jsonstr, signature string) (SoterResult, error) {
 	var result SoterResult
-	token, err := c.getAccessToken()
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return result, err
 	}
@@ -44,10 +50,13 @@ func (c *WXMiniClient) VerifySignature(openid, jsonstr, signature string) (Soter
 		reply
 		OK bool `json:"is_ok"`
 	}
-	err = c.httpPost(uri, req, &resp)
+	err = c.httpPost(ctx, uri, req, &resp)
 	if err != nil {
 		return result, err
 	}
+	if err = resp.Error(); err != nil {
+		return result, err
+	}
 	if !resp.OK {
 		return result, fmt.Errorf("SOTER verify signature failed, code:%d, message:%s", resp.ErrCode, resp.ErrMsg)
 	}
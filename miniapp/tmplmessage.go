@@ -2,7 +2,10 @@
 
 package miniapp
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 type MiniProgramState string
 
@@ -76,21 +79,32 @@ func (t *SubscribeMsgTmpl) Put(key, value string) *SubscribeMsgTmpl {
 
 // SendSubscribeMsg 发送订阅消息.
 func (c *WXMiniClient) SendSubscribeMsg(tmpl SubscribeMsgTmpl) error {
-	token, err := c.getAccessToken()
+	return c.SendSubscribeMsgContext(context.Background(), tmpl)
+}
+
+// SendSubscribeMsgContext 发送订阅消息.
+func (c *WXMiniClient) SendSubscribeMsgContext(ctx context.Context, tmpl SubscribeMsgTmpl) error {
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return err
 	}
 	uri := wxapp_subscribe_message_tmpl.Format(token)
 	var resp reply
-	err = c.httpPost(uri, tmpl, &resp)
+	err = c.httpPost(ctx, uri, tmpl, &resp)
 	if err != nil {
 		return err
 	}
 	return resp.Error()
 }
 
+// CreateActivityID 创建被分享动态消息或私密消息的 activity_id.
 func (c *WXMiniClient) CreateActivityID(openid, unionid string) (string, error) {
-	token, err := c.getAccessToken()
+	return c.CreateActivityIDContext(context.Background(), openid, unionid)
+}
+
+// CreateActivityIDContext 创建被分享动态消息或私密消息的 activity_id.
+func (c *WXMiniClient) CreateActivityIDContext(ctx context.Context, openid, unionid string) (string, error) {
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -106,7 +120,7 @@ func (c *WXMiniClient) CreateActivityID(openid, unionid string) (string, error)
 		ActivityID string `json:"activity_id"`
 		Experation int    `json:"expiration_time"` //activity_id 的过期时间戳。默认24小时后过期
 	}
-	err = c.httpGet(uri, &resp)
+	err = c.httpGet(ctx, uri, &resp)
 	if err != nil {
 		return "", err
 	}
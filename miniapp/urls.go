@@ -16,6 +16,10 @@ const (
 	url_link_short               APIURL = "https://api.weixin.qq.com/wxa/genwxashortlink?access_token=%s"
 	url_sms_send                 APIURL = "https://api.weixin.qq.com/tcb/sendsmsv2?access_token=%s"
 	url_activity_create          APIURL = "https://api.weixin.qq.com/cgi-bin/message/wxopen/activityid/create?access_token=%s"
+	url_custom_send              APIURL = "https://api.weixin.qq.com/cgi-bin/message/custom/send?access_token=%s"
+	url_custom_typing            APIURL = "https://api.weixin.qq.com/cgi-bin/message/custom/typing?access_token=%s"
+	url_media_upload             APIURL = "https://api.weixin.qq.com/cgi-bin/media/upload?access_token=%s&type=%s"
+	url_media_get                APIURL = "https://api.weixin.qq.com/cgi-bin/media/get?access_token=%s&media_id=%s"
 )
 
 func (uri APIURL) Format(args ...interface{}) string {
@@ -1,6 +1,8 @@
 // 小程序链接.
 package miniapp
 
+import "context"
+
 type URLSchemaGenReq struct {
 	JumpWxa struct {
 		// Path 通过 scheme 码进入的小程序页面路径，必须是已经发布的小程序存在的页面，不可携带 query。path 为空时会跳转小程序主页.
@@ -18,7 +20,12 @@ type OpenLink string
 // 通过该接口，可以选择生成到期失效和永久有效的小程序码，有数量限制，目前仅针对国内非个人主体的小程序开放,
 // 详情参考 https://developers.weixin.qq.com/miniprogram/dev/framework/open-ability/url-scheme.html.
 func (c *WXMiniClient) GenerateURLSchema(req URLSchemaGenReq) (OpenLink, error) {
-	token, err := c.getAccessToken()
+	return c.GenerateURLSchemaContext(context.Background(), req)
+}
+
+// GenerateURLSchemaContext 获取小程序 scheme 码.
+func (c *WXMiniClient) GenerateURLSchemaContext(ctx context.Context, req URLSchemaGenReq) (OpenLink, error) {
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return OpenLink(""), err
 	}
@@ -27,7 +34,7 @@ func (c *WXMiniClient) GenerateURLSchema(req URLSchemaGenReq) (OpenLink, error)
 		reply
 		OpenLink OpenLink `json:"openlink"`
 	}
-	err = c.httpPost(uri, req, &resp)
+	err = c.httpPost(ctx, uri, req, &resp)
 	if err != nil {
 		return resp.OpenLink, err
 	}
@@ -50,8 +57,14 @@ type URLSchemaDetail struct {
 	VisitOpenID string `json:"visit_openid"`
 }
 
+// QueryURLSchema 查询小程序 scheme 码.
 func (c *WXMiniClient) QueryURLSchema(schema OpenLink) (URLSchemaDetail, error) {
-	token, err := c.getAccessToken()
+	return c.QueryURLSchemaContext(context.Background(), schema)
+}
+
+// QueryURLSchemaContext 查询小程序 scheme 码.
+func (c *WXMiniClient) QueryURLSchemaContext(ctx context.Context, schema OpenLink) (URLSchemaDetail, error) {
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return URLSchemaDetail{}, err
 	}
@@ -61,7 +74,7 @@ func (c *WXMiniClient) QueryURLSchema(schema OpenLink) (URLSchemaDetail, error)
 		URLSchemaDetail
 	}
 	req := map[string]string{"scheme": string(schema)}
-	err = c.httpPost(uri, req, &resp)
+	err = c.httpPost(ctx, uri, req, &resp)
 	if err != nil {
 		return resp.URLSchemaDetail, err
 	}
@@ -101,7 +114,12 @@ type (
 // 通过该接口，可以选择生成到期失效和永久有效的小程序链接，有数量限制，目前仅针对国内非个人主体的小程序开放,
 // 详情参考 https://developers.weixin.qq.com/miniprogram/dev/framework/open-ability/url-link.html.
 func (c *WXMiniClient) GenerateURLLink(req URLLinkGenerateReq) (URLLink, error) {
-	token, err := c.getAccessToken()
+	return c.GenerateURLLinkContext(context.Background(), req)
+}
+
+// GenerateURLLinkContext 获取小程序 URL Link.
+func (c *WXMiniClient) GenerateURLLinkContext(ctx context.Context, req URLLinkGenerateReq) (URLLink, error) {
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return URLLink(""), err
 	}
@@ -110,7 +128,7 @@ func (c *WXMiniClient) GenerateURLLink(req URLLinkGenerateReq) (URLLink, error)
 		reply
 		URLLink URLLink `json:"url_link"`
 	}
-	err = c.httpPost(uri, req, &resp)
+	err = c.httpPost(ctx, uri, req, &resp)
 	if err != nil {
 		return resp.URLLink, err
 	}
@@ -139,8 +157,14 @@ type URLLinkDetail struct {
 	VisitOpenID string `json:"visit_openid"`
 }
 
+// QueryURLLink 查询小程序 URL Link.
 func (c *WXMiniClient) QueryURLLink(link URLLink) (URLLinkDetail, error) {
-	token, err := c.getAccessToken()
+	return c.QueryURLLinkContext(context.Background(), link)
+}
+
+// QueryURLLinkContext 查询小程序 URL Link.
+func (c *WXMiniClient) QueryURLLinkContext(ctx context.Context, link URLLink) (URLLinkDetail, error) {
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return URLLinkDetail{}, err
 	}
@@ -150,7 +174,7 @@ func (c *WXMiniClient) QueryURLLink(link URLLink) (URLLinkDetail, error) {
 		URLLinkDetail
 	}
 	req := map[string]string{"url_link": string(link)}
-	err = c.httpPost(uri, req, &resp)
+	err = c.httpPost(ctx, uri, req, &resp)
 	if err != nil {
 		return resp.URLLinkDetail, err
 	}
@@ -179,7 +203,12 @@ type ShortURLLinkGenerateReq struct {
 // 单个小程序总共可生成永久有效 ShortLink 上限为10万个，请谨慎调用。
 // 短期有效ShortLink 有效时间为30天，单个小程序生成短期有效ShortLink 不设上限.
 func (c *WXMiniClient) GenerateShortURLLink(req ShortURLLinkGenerateReq) (URLLink, error) {
-	token, err := c.getAccessToken()
+	return c.GenerateShortURLLinkContext(context.Background(), req)
+}
+
+// GenerateShortURLLinkContext 获取小程序 Short Link.
+func (c *WXMiniClient) GenerateShortURLLinkContext(ctx context.Context, req ShortURLLinkGenerateReq) (URLLink, error) {
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return URLLink(""), err
 	}
@@ -188,7 +217,7 @@ func (c *WXMiniClient) GenerateShortURLLink(req ShortURLLinkGenerateReq) (URLLin
 		reply
 		URLLink URLLink `json:"url_link"`
 	}
-	err = c.httpPost(uri, req, &resp)
+	err = c.httpPost(ctx, uri, req, &resp)
 	if err != nil {
 		return resp.URLLink, err
 	}
@@ -207,7 +236,12 @@ type NFCSchemaGenReq struct {
 // GenerateNFCSchema 用于获取用于 NFC 的小程序 scheme 码，适用于 NFC 拉起小程序的业务场景。
 // 目前仅针对国内非个人主体的小程序开放，详见 NFC 标签打开小程序。
 func (c *WXMiniClient) GenerateNFCSchema(req NFCSchemaGenReq) (OpenLink, error) {
-	token, err := c.getAccessToken()
+	return c.GenerateNFCSchemaContext(context.Background(), req)
+}
+
+// GenerateNFCSchemaContext 获取用于 NFC 的小程序 scheme 码.
+func (c *WXMiniClient) GenerateNFCSchemaContext(ctx context.Context, req NFCSchemaGenReq) (OpenLink, error) {
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return OpenLink(""), err
 	}
@@ -216,7 +250,7 @@ func (c *WXMiniClient) GenerateNFCSchema(req NFCSchemaGenReq) (OpenLink, error)
 		reply
 		OpenLink OpenLink `json:"openlink"`
 	}
-	err = c.httpPost(uri, req, &resp)
+	err = c.httpPost(ctx, uri, req, &resp)
 	if err != nil {
 		return resp.OpenLink, err
 	}
@@ -4,11 +4,12 @@ package miniapp
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"net/url"
+	"strings"
 )
 
 // CodeGenArg 小程序码生成参数
@@ -33,8 +34,13 @@ type CodeGenArg struct {
 // 通过该接口生成的小程序码，永久有效，数量限制见文末说明，请谨慎使用。
 // 用户扫描该码进入小程序后，将直接进入 path 对应的页面
 func (c *WXMiniClient) WXACode_A(arg CodeGenArg) (io.Reader, error) {
+	return c.WXACode_AContext(context.Background(), arg)
+}
+
+// WXACode_AContext 生成小程序码, 参见 WXACode_A
+func (c *WXMiniClient) WXACode_AContext(ctx context.Context, arg CodeGenArg) (io.Reader, error) {
 	const uri = "https://api.weixin.qq.com/wxa/getwxacode?access_token=%s"
-	return c.genWXACode(uri, arg)
+	return c.genWXACode(ctx, uri, arg)
 }
 
 // WXACode_B 适用于需要的码数量极多，或仅临时使用的业务场景
@@ -44,37 +50,48 @@ func (c *WXMiniClient) WXACode_A(arg CodeGenArg) (io.Reader, error) {
 // 调试阶段可以使用开发工具的条件编译自定义参数 scene=xxxx 进行模拟，
 // 开发工具模拟时的 scene 的参数值需要进行 urlencode
 func (c *WXMiniClient) WXACode_B(arg CodeGenArg) (io.Reader, error) {
+	return c.WXACode_BContext(context.Background(), arg)
+}
+
+// WXACode_BContext 生成小程序码, 参见 WXACode_B
+func (c *WXMiniClient) WXACode_BContext(ctx context.Context, arg CodeGenArg) (io.Reader, error) {
 	const uri = "https://api.weixin.qq.com/wxa/getwxacodeunlimit?access_token=%s"
 	if arg.Sence == "" {
 		return nil, fmt.Errorf("Sence is mandatory")
 	}
 	arg.Sence = url.QueryEscape(arg.Sence)
-	return c.genWXACode(uri, arg)
+	return c.genWXACode(ctx, uri, arg)
 }
 
 // WXACode_C 适用于需要的码数量较少的业务场景
 // 通过该接口生成的小程序二维码，永久有效，数量限制见文末说明，请谨慎使用。
 // 用户扫描该码进入小程序后，将直接进入 path 对应的页面
 func (c *WXMiniClient) WXACode_C(arg CodeGenArg) (io.Reader, error) {
+	return c.WXACode_CContext(context.Background(), arg)
+}
+
+// WXACode_CContext 生成小程序码, 参见 WXACode_C
+func (c *WXMiniClient) WXACode_CContext(ctx context.Context, arg CodeGenArg) (io.Reader, error) {
 	const uri = "https://api.weixin.qq.com/cgi-bin/wxaapp/createwxaqrcode?access_token=%s"
-	return c.genWXACode(uri, arg)
+	return c.genWXACode(ctx, uri, arg)
 }
 
-func (c *WXMiniClient) genWXACode(uri string, data interface{}) (io.Reader, error) {
-	token, err := c.getAccessToken()
+func (c *WXMiniClient) genWXACode(ctx context.Context, uri string, data interface{}) (io.Reader, error) {
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return nil, err
 	}
-	var buf bytes.Buffer
-	json.NewEncoder(&buf).Encode(data)
-	res, err := http.Post(fmt.Sprintf(uri, token), "application/json", &buf)
-	if res != nil {
-		defer res.Body.Close()
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
 	}
+	resp, err := c.api.Download(ctx, "POST", fmt.Sprintf(uri, token), body, "application/json")
 	if err != nil {
 		return nil, err
 	}
-	buf.Reset()
-	io.Copy(&buf, res.Body)
-	return &buf, nil
+	// 生成失败时返回JSON格式的错误信息
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return nil, fmt.Errorf("Unexpected response, content-type:%s", resp.Header.Get("Content-Type"))
+	}
+	return bytes.NewReader(resp.Body), nil
 }
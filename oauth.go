@@ -0,0 +1,347 @@
+// 网页授权
+
+package wxdev
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 网页授权作用域
+const (
+	OAuthScopeBase     = "snsapi_base"     // 静默授权, 仅能获取openid
+	OAuthScopeUserInfo = "snsapi_userinfo" // 需用户确认, 可获取用户基本信息
+)
+
+// AuthCodeURL 生成网页授权地址, 用户同意授权后跳转至 redirect?code=CODE&state=STATE
+func (c *WXClient) AuthCodeURL(redirect, scope, state string) string {
+	const uri = "https://open.weixin.qq.com/connect/oauth2/authorize?appid=%s&redirect_uri=%s&response_type=code&scope=%s&state=%s#wechat_redirect"
+	return fmt.Sprintf(uri, c.appid, url.QueryEscape(redirect), scope, url.QueryEscape(state))
+}
+
+// snsGet 调用网页授权接口, 请求携带的是用户的网页授权access_token, 因此不做access_token失效重试
+func (c *WXClient) snsGet(ctx context.Context, uri string, v interface{}) error {
+	resp, err := c.api.Request(ctx, "GET", uri, nil, "")
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(resp.Body, v)
+}
+
+// RefreshLoginToken 刷新网页授权access_token, refresh_token有效期为30天
+func (c *WXClient) RefreshLoginToken(refreshToken string) (LoginAccessToken, error) {
+	return c.RefreshLoginTokenContext(context.Background(), refreshToken)
+}
+
+// RefreshLoginTokenContext 刷新网页授权access_token, refresh_token有效期为30天
+func (c *WXClient) RefreshLoginTokenContext(ctx context.Context, refreshToken string) (LoginAccessToken, error) {
+	const uri = "https://api.weixin.qq.com/sns/oauth2/refresh_token?appid=%s&grant_type=refresh_token&refresh_token=%s"
+	var token LoginAccessToken
+	if err := c.snsGet(ctx, fmt.Sprintf(uri, c.appid, url.QueryEscape(refreshToken)), &token); err != nil {
+		return token, err
+	}
+	if token.ErrCode != 0 {
+		return token, NewAPIError(token.ErrCode, token.ErrMsg)
+	}
+	return token, nil
+}
+
+// ValidateLoginToken 检验网页授权access_token是否有效
+func (c *WXClient) ValidateLoginToken(accessToken, openid string) error {
+	return c.ValidateLoginTokenContext(context.Background(), accessToken, openid)
+}
+
+// ValidateLoginTokenContext 检验网页授权access_token是否有效
+func (c *WXClient) ValidateLoginTokenContext(ctx context.Context, accessToken, openid string) error {
+	const uri = "https://api.weixin.qq.com/sns/auth?access_token=%s&openid=%s"
+	var result apiReply
+	if err := c.snsGet(ctx, fmt.Sprintf(uri, url.QueryEscape(accessToken), url.QueryEscape(openid)), &result); err != nil {
+		return err
+	}
+	return result.Error()
+}
+
+// SNSUserInfo 网页授权获取的用户信息
+type SNSUserInfo struct {
+	OpenID     string    `json:"openid"`
+	NickName   string    `json:"nickname"`
+	Sex        WXSexType `json:"sex"`
+	Province   string    `json:"province"`
+	City       string    `json:"city"`
+	Country    string    `json:"country"`
+	HeadImgUrl string    `json:"headimgurl"`
+	Privilege  []string  `json:"privilege"`
+	UnionID    string    `json:"unionid"`
+}
+
+// GetSNSUserInfo 拉取用户信息, 需scope为snsapi_userinfo, lang 为空时默认zh_CN
+func (c *WXClient) GetSNSUserInfo(accessToken, openid, lang string) (SNSUserInfo, error) {
+	return c.GetSNSUserInfoContext(context.Background(), accessToken, openid, lang)
+}
+
+// GetSNSUserInfoContext 拉取用户信息, 需scope为snsapi_userinfo, lang 为空时默认zh_CN
+func (c *WXClient) GetSNSUserInfoContext(ctx context.Context, accessToken, openid, lang string) (SNSUserInfo, error) {
+	const uri = "https://api.weixin.qq.com/sns/userinfo?access_token=%s&openid=%s&lang=%s"
+	if lang == "" {
+		lang = "zh_CN"
+	}
+	var result struct {
+		apiReply
+		SNSUserInfo
+	}
+	err := c.snsGet(ctx, fmt.Sprintf(uri, url.QueryEscape(accessToken), url.QueryEscape(openid), lang), &result)
+	if err != nil {
+		return SNSUserInfo{}, err
+	}
+	return result.SNSUserInfo, result.Error()
+}
+
+// ErrOAuthDeclined 用户拒绝授权, 微信回调时仅携带state而没有code
+var ErrOAuthDeclined = errors.New("WXDev: oauth declined by user")
+
+// OAuthUser 网页授权得到的用户身份
+type OAuthUser struct {
+	OpenID  string
+	UnionID string
+}
+
+type oauthUserKey struct{}
+
+// OAuthUserFromContext 返回 OAuthMiddleware 放入请求上下文的用户身份
+func OAuthUserFromContext(ctx context.Context) (OAuthUser, bool) {
+	user, ok := ctx.Value(oauthUserKey{}).(OAuthUser)
+	return user, ok
+}
+
+// OAuthOption 网页授权中间件配置
+type OAuthOption func(*OAuthMiddleware)
+
+// WithOAuthScope 设置授权作用域, 默认为 snsapi_base
+func WithOAuthScope(scope string) OAuthOption {
+	return func(m *OAuthMiddleware) { m.scope = scope }
+}
+
+// WithOAuthSecret 设置签名登录cookie的密钥, 未设置时使用随机密钥, 进程重启后用户需重新授权
+func WithOAuthSecret(secret []byte) OAuthOption {
+	return func(m *OAuthMiddleware) { m.secret = secret }
+}
+
+// WithOAuthCookie 设置登录cookie的名称及有效期, 默认为 wxoauth 及2小时
+func WithOAuthCookie(name string, maxAge time.Duration) OAuthOption {
+	return func(m *OAuthMiddleware) { m.cookieName, m.maxAge = name, maxAge }
+}
+
+// WithOAuthRedirectURL 设置授权回调地址, 默认根据请求的Host及X-Forwarded-Proto还原当前地址
+func WithOAuthRedirectURL(fn func(r *http.Request) string) OAuthOption {
+	return func(m *OAuthMiddleware) { m.redirectURL = fn }
+}
+
+// WithOAuthErrorHandler 设置授权失败时的处理函数, 默认返回403, 用户拒绝授权时err为 ErrOAuthDeclined
+func WithOAuthErrorHandler(fn func(w http.ResponseWriter, r *http.Request, err error)) OAuthOption {
+	return func(m *OAuthMiddleware) { m.onError = fn }
+}
+
+// OAuthMiddleware 网页授权中间件, 未授权的GET请求跳转至微信授权页并写入state cookie,
+// 授权回调时校验state并通过code换取openid, 之后以签名cookie保持登录状态并跳转回去掉code及state的地址
+type OAuthMiddleware struct {
+	c           *WXClient
+	scope       string
+	secret      []byte
+	cookieName  string
+	maxAge      time.Duration
+	redirectURL func(r *http.Request) string
+	onError     func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// NewOAuthMiddleware 创建网页授权中间件
+func (c *WXClient) NewOAuthMiddleware(options ...OAuthOption) *OAuthMiddleware {
+	m := &OAuthMiddleware{
+		c:           c,
+		scope:       OAuthScopeBase,
+		cookieName:  "wxoauth",
+		maxAge:      2 * time.Hour,
+		redirectURL: currentURL,
+		onError: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		},
+	}
+	for _, fn := range options {
+		fn(m)
+	}
+	if len(m.secret) == 0 {
+		m.secret = make([]byte, 32)
+		rand.Read(m.secret)
+	}
+	return m
+}
+
+// Handler 包装http.Handler, 授权成功后可通过 OAuthUserFromContext 获取用户身份
+func (m *OAuthMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := m.userFromCookie(r); ok {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), oauthUserKey{}, user)))
+			return
+		}
+		// 只有发起过授权(存在state cookie)的请求才视为授权回调, 避免业务自身的code参数被误认为授权码,
+		// 用户拒绝授权时回调只携带state, 交由onError处理而不是再次跳转授权页
+		if _, err := r.Cookie(m.cookieName + "_state"); err == nil {
+			if code, state, uri := oauthCallback(r.URL); state != "" {
+				user, err := m.exchange(r, code, state)
+				if err != nil {
+					m.onError(w, r, err)
+					return
+				}
+				m.setUserCookie(w, r, user)
+				// 跳转回原地址, 避免code留在地址栏及浏览记录中
+				http.Redirect(w, r, uri, http.StatusFound)
+				return
+			}
+		}
+		if r.Method != "GET" {
+			m.onError(w, r, fmt.Errorf("WXDev: oauth required"))
+			return
+		}
+		state := randomHex(16)
+		http.SetCookie(w, &http.Cookie{
+			Name: m.cookieName + "_state", Value: state, Path: "/", MaxAge: 600,
+			HttpOnly: true, Secure: isHTTPS(r), SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, m.c.AuthCodeURL(m.redirectURL(r), m.scope, state), http.StatusFound)
+	})
+}
+
+// Gin 返回Gin中间件, 授权成功后可通过 OAuthUserFromContext(ctx.Request.Context()) 获取用户身份
+func (m *OAuthMiddleware) Gin() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		passed := false
+		m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			passed = true
+			ctx.Request = r
+			ctx.Next()
+		})).ServeHTTP(ctx.Writer, ctx.Request)
+		if !passed {
+			ctx.Abort()
+		}
+	}
+}
+
+// exchange 校验state并使用code换取用户身份
+func (m *OAuthMiddleware) exchange(r *http.Request, code, state string) (OAuthUser, error) {
+	cookie, err := r.Cookie(m.cookieName + "_state")
+	if err != nil || state == "" || !hmac.Equal([]byte(cookie.Value), []byte(state)) {
+		return OAuthUser{}, fmt.Errorf("WXDev: oauth state mismatch")
+	}
+	if code == "" {
+		return OAuthUser{}, ErrOAuthDeclined
+	}
+	token, err := m.c.GetLoginAccessTokenContext(r.Context(), code)
+	if err != nil {
+		return OAuthUser{}, err
+	}
+	return OAuthUser{OpenID: token.OpenID, UnionID: token.UnionID}, nil
+}
+
+// 登录cookie格式为 base64(openid|unionid|过期时间).签名
+func (m *OAuthMiddleware) setUserCookie(w http.ResponseWriter, r *http.Request, user OAuthUser) {
+	expire := time.Now().Add(m.maxAge)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(
+		strings.Join([]string{user.OpenID, user.UnionID, strconv.FormatInt(expire.Unix(), 10)}, "|")))
+	http.SetCookie(w, &http.Cookie{
+		Name: m.cookieName, Value: payload + "." + m.sign(payload), Path: "/", Expires: expire,
+		HttpOnly: true, Secure: isHTTPS(r), SameSite: http.SameSiteLaxMode,
+	})
+	// 清除state
+	http.SetCookie(w, &http.Cookie{Name: m.cookieName + "_state", Path: "/", MaxAge: -1, HttpOnly: true, Secure: isHTTPS(r)})
+}
+
+func (m *OAuthMiddleware) userFromCookie(r *http.Request) (OAuthUser, bool) {
+	cookie, err := r.Cookie(m.cookieName)
+	if err != nil {
+		return OAuthUser{}, false
+	}
+	idx := strings.LastIndex(cookie.Value, ".")
+	if idx < 0 || !hmac.Equal([]byte(cookie.Value[idx+1:]), []byte(m.sign(cookie.Value[:idx]))) {
+		return OAuthUser{}, false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cookie.Value[:idx])
+	if err != nil {
+		return OAuthUser{}, false
+	}
+	fields := strings.Split(string(data), "|")
+	if len(fields) != 3 {
+		return OAuthUser{}, false
+	}
+	expire, _ := strconv.ParseInt(fields[2], 10, 64)
+	if time.Now().Unix() > expire {
+		return OAuthUser{}, false
+	}
+	return OAuthUser{OpenID: fields[0], UnionID: fields[1]}, true
+}
+
+func (m *OAuthMiddleware) sign(payload string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// oauthCallback 返回微信追加在回调地址末尾的code及state, 以及去掉这两个参数后的请求地址
+func oauthCallback(u *url.URL) (code, state, uri string) {
+	q := u.Query()
+	last := func(key string) string {
+		values := q[key]
+		if len(values) == 0 {
+			return ""
+		}
+		if len(values) == 1 {
+			q.Del(key)
+		} else {
+			q[key] = values[:len(values)-1]
+		}
+		return values[len(values)-1]
+	}
+	code, state = last("code"), last("state")
+	uri = u.EscapedPath()
+	if len(q) > 0 {
+		uri += "?" + q.Encode()
+	}
+	return code, state, uri
+}
+
+// requestScheme 返回请求的协议, 经反向代理时以X-Forwarded-Proto为准
+func requestScheme(r *http.Request) string {
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		return proto
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// isHTTPS 请求是否经由HTTPS, 与回调地址使用相同的判断以保证cookie的Secure属性一致
+func isHTTPS(r *http.Request) bool { return requestScheme(r) == "https" }
+
+// currentURL 还原请求的完整地址
+func currentURL(r *http.Request) string {
+	return requestScheme(r) + "://" + r.Host + r.URL.RequestURI()
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
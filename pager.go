@@ -0,0 +1,69 @@
+// 分页接口迭代器
+
+package wxdev
+
+import "context"
+
+// pageFetcher 拉取下一页, 返回本页数据、总数(接口不返回时为0)及是否为最后一页
+type pageFetcher[T any] func() (items []T, total int, last bool, err error)
+
+// PageIterator 分页接口迭代器, 按需逐页拉取
+//
+//	it := c.IterateKfMsgRecords(ctx, start, end, 0)
+//	for it.Next() {
+//		record := it.Item()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type PageIterator[T any] struct {
+	fetch   pageFetcher[T]
+	total   int
+	items   []T
+	current T
+	done    bool
+	err     error
+}
+
+func newPageIterator[T any](fetch pageFetcher[T]) *PageIterator[T] {
+	return &PageIterator[T]{fetch: fetch}
+}
+
+// Next 移动到下一项, 没有更多数据或出错时返回false
+func (it *PageIterator[T]) Next() bool {
+	for len(it.items) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		items, total, last, err := it.fetch()
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.items, it.total, it.done = items, total, last
+	}
+	it.current, it.items = it.items[0], it.items[1:]
+	return true
+}
+
+// Item 当前项
+func (it *PageIterator[T]) Item() T { return it.current }
+
+// Total 数据总数, 在第一次调用 Next 后有效, 接口不返回总数时为0
+func (it *PageIterator[T]) Total() int { return it.total }
+
+// Err 迭代过程中的错误
+func (it *PageIterator[T]) Err() error { return it.err }
+
+// iterateOpenIDs 按next_openid分页遍历openid列表
+func iterateOpenIDs(ctx context.Context, fetchPage func(ctx context.Context, nextOpenID string) (FollowerPage, error)) *PageIterator[string] {
+	var nextID string
+	return newPageIterator(func() ([]string, int, bool, error) {
+		page, err := fetchPage(ctx, nextID)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		nextID = page.NextID
+		// 拉取完毕后微信仍会返回最后一个openid作为next_openid, 以空页作为结束标志
+		return page.OpenIDs, page.Total, len(page.OpenIDs) == 0 || page.NextID == "", nil
+	})
+}
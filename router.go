@@ -0,0 +1,212 @@
+// 消息路由
+
+package wxdev
+
+import (
+	"log"
+	"regexp"
+	"runtime/debug"
+	"strings"
+)
+
+// Middleware 消息处理中间件
+type Middleware func(WXMessageHandler) WXMessageHandler
+
+type textMatcher struct {
+	match   func(string) bool
+	handler WXMessageHandler
+}
+
+// MessageRouter 消息路由, 按消息类型、事件类型、EventKey及文本内容分发消息
+type MessageRouter struct {
+	middlewares []Middleware
+	msgHandlers map[WXMessageType]WXMessageHandler
+	evtHandlers map[WXEventType]WXMessageHandler
+	keyHandlers map[WXEventType]map[string]WXMessageHandler
+	matchers    []textMatcher
+	fallback    WXMessageHandler
+}
+
+// NewMessageRouter 创建消息路由
+func NewMessageRouter() *MessageRouter {
+	return &MessageRouter{
+		msgHandlers: make(map[WXMessageType]WXMessageHandler),
+		evtHandlers: make(map[WXEventType]WXMessageHandler),
+		keyHandlers: make(map[WXEventType]map[string]WXMessageHandler),
+	}
+}
+
+// Use 注册中间件, 先注册的中间件位于调用链外层
+func (r *MessageRouter) Use(middlewares ...Middleware) *MessageRouter {
+	r.middlewares = append(r.middlewares, middlewares...)
+	return r
+}
+
+// OnMessage 按消息类型注册处理器
+func (r *MessageRouter) OnMessage(t WXMessageType, handler WXMessageHandler) *MessageRouter {
+	r.msgHandlers[t] = handler
+	return r
+}
+
+// OnText 文本消息
+func (r *MessageRouter) OnText(handler WXMessageHandler) *MessageRouter {
+	return r.OnMessage(WXMsgTypeText, handler)
+}
+
+// OnImage 图片消息
+func (r *MessageRouter) OnImage(handler WXMessageHandler) *MessageRouter {
+	return r.OnMessage(WXMsgTypeImage, handler)
+}
+
+// OnVoice 语音消息
+func (r *MessageRouter) OnVoice(handler WXMessageHandler) *MessageRouter {
+	return r.OnMessage(WXMsgTypeVoice, handler)
+}
+
+// OnVideo 视频消息
+func (r *MessageRouter) OnVideo(handler WXMessageHandler) *MessageRouter {
+	return r.OnMessage(WXMsgTypeVideo, handler)
+}
+
+// OnShortVideo 小视频消息
+func (r *MessageRouter) OnShortVideo(handler WXMessageHandler) *MessageRouter {
+	return r.OnMessage(WXMsgTypeShortVideo, handler)
+}
+
+// OnLocation 地理位置消息
+func (r *MessageRouter) OnLocation(handler WXMessageHandler) *MessageRouter {
+	return r.OnMessage(WXMsgTypeLocation, handler)
+}
+
+// OnLink 链接消息
+func (r *MessageRouter) OnLink(handler WXMessageHandler) *MessageRouter {
+	return r.OnMessage(WXMsgTypeLink, handler)
+}
+
+// OnEvent 按事件类型注册处理器
+func (r *MessageRouter) OnEvent(e WXEventType, handler WXMessageHandler) *MessageRouter {
+	r.evtHandlers[e] = handler
+	return r
+}
+
+// OnEventKey 按事件类型及EventKey注册处理器, 关注事件的qrscene_前缀会被忽略
+func (r *MessageRouter) OnEventKey(e WXEventType, key string, handler WXMessageHandler) *MessageRouter {
+	handlers, has := r.keyHandlers[e]
+	if !has {
+		handlers = make(map[string]WXMessageHandler)
+		r.keyHandlers[e] = handlers
+	}
+	handlers[key] = handler
+	return r
+}
+
+// OnClick 点击菜单事件
+func (r *MessageRouter) OnClick(key string, handler WXMessageHandler) *MessageRouter {
+	return r.OnEventKey(EventTypeClick, key, handler)
+}
+
+// OnScene 扫描带参数二维码事件, 包含已关注用户扫码及未关注用户扫码关注
+func (r *MessageRouter) OnScene(scene string, handler WXMessageHandler) *MessageRouter {
+	r.OnEventKey(EventTypeScan, scene, handler)
+	return r.OnEventKey(EventTypeSubscribe, scene, handler)
+}
+
+// OnKeyword 文本消息关键字完全匹配(忽略首尾空白)
+func (r *MessageRouter) OnKeyword(keyword string, handler WXMessageHandler) *MessageRouter {
+	r.matchers = append(r.matchers, textMatcher{
+		match:   func(content string) bool { return strings.TrimSpace(content) == keyword },
+		handler: handler,
+	})
+	return r
+}
+
+// OnRegexp 文本消息正则匹配
+func (r *MessageRouter) OnRegexp(expr *regexp.Regexp, handler WXMessageHandler) *MessageRouter {
+	r.matchers = append(r.matchers, textMatcher{match: expr.MatchString, handler: handler})
+	return r
+}
+
+// Fallback 未匹配任何路由时的处理器
+func (r *MessageRouter) Fallback(handler WXMessageHandler) *MessageRouter {
+	r.fallback = handler
+	return r
+}
+
+// Handle 分发消息, 可直接作为 MessageHandleFunc 的参数
+func (r *MessageRouter) Handle(req WXMessageRequest) WXMessageResponse {
+	handler := r.route(req)
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		handler = r.middlewares[i](handler)
+	}
+	return handler(req)
+}
+
+func (r *MessageRouter) route(req WXMessageRequest) WXMessageHandler {
+	if req.IsEvent() {
+		if handler, has := r.keyHandlers[req.Event][req.GetEventKey()]; has {
+			return handler
+		}
+		if handler, has := r.evtHandlers[req.Event]; has {
+			return handler
+		}
+		return r.fallbackHandler()
+	}
+	if req.MsgType == WXMsgTypeText {
+		for _, m := range r.matchers {
+			if m.match(req.Content) {
+				return m.handler
+			}
+		}
+	}
+	if handler, has := r.msgHandlers[req.MsgType]; has {
+		return handler
+	}
+	return r.fallbackHandler()
+}
+
+func (r *MessageRouter) fallbackHandler() WXMessageHandler {
+	if r.fallback != nil {
+		return r.fallback
+	}
+	return func(WXMessageRequest) WXMessageResponse { return WXMessageOKResponse{} }
+}
+
+// RecoveryMiddleware 捕获处理器panic, 记录日志并回复success
+func RecoveryMiddleware(next WXMessageHandler) WXMessageHandler {
+	return func(req WXMessageRequest) (resp WXMessageResponse) {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Printf("WXDev: handle message panic, error:%v\n%s", err, debug.Stack())
+				resp = WXMessageOKResponse{}
+			}
+		}()
+		return next(req)
+	}
+}
+
+// LoggingMiddleware 记录消息日志
+func LoggingMiddleware(next WXMessageHandler) WXMessageHandler {
+	return func(req WXMessageRequest) WXMessageResponse {
+		if req.IsEvent() {
+			log.Printf("WXDev: receive event, from:%s, event:%s, key:%s", req.FromUserName, req.Event, req.EventKey)
+		} else {
+			log.Printf("WXDev: receive message, from:%s, type:%s, id:%d", req.FromUserName, req.MsgType, req.MsgId)
+		}
+		return next(req)
+	}
+}
+
+// AuthMiddleware 按openid鉴权, allow 返回false时回复 deny 的结果
+func AuthMiddleware(allow func(openid string) bool, deny WXMessageHandler) Middleware {
+	return func(next WXMessageHandler) WXMessageHandler {
+		return func(req WXMessageRequest) WXMessageResponse {
+			if allow(req.FromUserName) {
+				return next(req)
+			}
+			if deny != nil {
+				return deny(req)
+			}
+			return WXMessageOKResponse{}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// 用户标签管理
+
+package wxdev
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	url_tagCreate         = "https://api.weixin.qq.com/cgi-bin/tags/create?access_token=%s"
+	url_tagGet            = "https://api.weixin.qq.com/cgi-bin/tags/get?access_token=%s"
+	url_tagUpdate         = "https://api.weixin.qq.com/cgi-bin/tags/update?access_token=%s"
+	url_tagDelete         = "https://api.weixin.qq.com/cgi-bin/tags/delete?access_token=%s"
+	url_tagBatchTagging   = "https://api.weixin.qq.com/cgi-bin/tags/members/batchtagging?access_token=%s"
+	url_tagBatchUntagging = "https://api.weixin.qq.com/cgi-bin/tags/members/batchuntagging?access_token=%s"
+	url_tagGetIDList      = "https://api.weixin.qq.com/cgi-bin/tags/getidlist?access_token=%s"
+	url_tagUsers          = "https://api.weixin.qq.com/cgi-bin/user/tag/get?access_token=%s"
+)
+
+// UserTag 用户标签
+type UserTag struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count,omitempty"` // 此标签下粉丝数
+}
+
+// CreateTag 创建标签, 标签名不超过30个字符
+func (c *WXClient) CreateTag(name string) (UserTag, error) {
+	return c.CreateTagContext(context.Background(), name)
+}
+
+// CreateTagContext 创建标签, 标签名不超过30个字符
+func (c *WXClient) CreateTagContext(ctx context.Context, name string) (UserTag, error) {
+	var result struct {
+		apiReply
+		Tag UserTag `json:"tag"`
+	}
+	data := map[string]interface{}{"tag": map[string]string{"name": name}}
+	if err := c.tagPost(ctx, url_tagCreate, data, &result); err != nil {
+		return UserTag{}, err
+	}
+	return result.Tag, result.Error()
+}
+
+// GetTags 获取已创建的标签
+func (c *WXClient) GetTags() ([]UserTag, error) {
+	return c.GetTagsContext(context.Background())
+}
+
+// GetTagsContext 获取已创建的标签
+func (c *WXClient) GetTagsContext(ctx context.Context) ([]UserTag, error) {
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		apiReply
+		Tags []UserTag `json:"tags"`
+	}
+	if err = c.httpGet(ctx, fmt.Sprintf(url_tagGet, token), &result); err != nil {
+		return nil, err
+	}
+	return result.Tags, result.Error()
+}
+
+// UpdateTag 编辑标签名
+func (c *WXClient) UpdateTag(tagid int, name string) error {
+	return c.UpdateTagContext(context.Background(), tagid, name)
+}
+
+// UpdateTagContext 编辑标签名
+func (c *WXClient) UpdateTagContext(ctx context.Context, tagid int, name string) error {
+	data := map[string]interface{}{"tag": UserTag{ID: tagid, Name: name}}
+	var result apiReply
+	if err := c.tagPost(ctx, url_tagUpdate, data, &result); err != nil {
+		return err
+	}
+	return result.Error()
+}
+
+// DeleteTag 删除标签, 粉丝数超过10w的标签无法直接删除
+func (c *WXClient) DeleteTag(tagid int) error {
+	return c.DeleteTagContext(context.Background(), tagid)
+}
+
+// DeleteTagContext 删除标签
+func (c *WXClient) DeleteTagContext(ctx context.Context, tagid int) error {
+	data := map[string]interface{}{"tag": map[string]int{"id": tagid}}
+	var result apiReply
+	if err := c.tagPost(ctx, url_tagDelete, data, &result); err != nil {
+		return err
+	}
+	return result.Error()
+}
+
+// BatchTagging 批量为用户打标签, 每次最多50个openid
+func (c *WXClient) BatchTagging(tagid int, openids ...string) error {
+	return c.BatchTaggingContext(context.Background(), tagid, openids...)
+}
+
+// BatchTaggingContext 批量为用户打标签, 每次最多50个openid
+func (c *WXClient) BatchTaggingContext(ctx context.Context, tagid int, openids ...string) error {
+	return c.batchTag(ctx, url_tagBatchTagging, tagid, openids)
+}
+
+// BatchUntagging 批量为用户取消标签, 每次最多50个openid
+func (c *WXClient) BatchUntagging(tagid int, openids ...string) error {
+	return c.BatchUntaggingContext(context.Background(), tagid, openids...)
+}
+
+// BatchUntaggingContext 批量为用户取消标签, 每次最多50个openid
+func (c *WXClient) BatchUntaggingContext(ctx context.Context, tagid int, openids ...string) error {
+	return c.batchTag(ctx, url_tagBatchUntagging, tagid, openids)
+}
+
+func (c *WXClient) batchTag(ctx context.Context, uri string, tagid int, openids []string) error {
+	if len(openids) <= 0 || len(openids) > 50 {
+		return fmt.Errorf("Cannot be more than 50 records one time")
+	}
+	data := struct {
+		OpenIDs []string `json:"openid_list"`
+		TagID   int      `json:"tagid"`
+	}{openids, tagid}
+	var result apiReply
+	if err := c.tagPost(ctx, uri, data, &result); err != nil {
+		return err
+	}
+	return result.Error()
+}
+
+// GetUserTagIDs 获取用户身上的标签ID列表
+func (c *WXClient) GetUserTagIDs(openid string) ([]int, error) {
+	return c.GetUserTagIDsContext(context.Background(), openid)
+}
+
+// GetUserTagIDsContext 获取用户身上的标签ID列表
+func (c *WXClient) GetUserTagIDsContext(ctx context.Context, openid string) ([]int, error) {
+	var result struct {
+		apiReply
+		TagIDs []int `json:"tagid_list"`
+	}
+	if err := c.tagPost(ctx, url_tagGetIDList, map[string]string{"openid": openid}, &result); err != nil {
+		return nil, err
+	}
+	return result.TagIDs, result.Error()
+}
+
+// GetTagUsers 获取标签下粉丝列表, nextOpenID 为空时从头开始拉取, 每页最多10000个
+func (c *WXClient) GetTagUsers(tagid int, nextOpenID string) (FollowerPage, error) {
+	return c.GetTagUsersContext(context.Background(), tagid, nextOpenID)
+}
+
+// GetTagUsersContext 获取标签下粉丝列表, nextOpenID 为空时从头开始拉取, 每页最多10000个
+func (c *WXClient) GetTagUsersContext(ctx context.Context, tagid int, nextOpenID string) (FollowerPage, error) {
+	data := struct {
+		TagID      int    `json:"tagid"`
+		NextOpenID string `json:"next_openid"`
+	}{tagid, nextOpenID}
+	var result struct {
+		apiReply
+		Count int `json:"count"`
+		Data  struct {
+			OpenIDs []string `json:"openid"`
+		} `json:"data"`
+		NextOpenID string `json:"next_openid"`
+	}
+	if err := c.tagPost(ctx, url_tagUsers, data, &result); err != nil {
+		return FollowerPage{}, err
+	}
+	if err := result.Error(); err != nil {
+		return FollowerPage{}, err
+	}
+	return FollowerPage{OpenIDs: result.Data.OpenIDs, NextID: result.NextOpenID}, nil
+}
+
+// ListTagUsers 按next_openid分页遍历标签下的粉丝, 迭代器的 Total 始终为0
+func (c *WXClient) ListTagUsers(ctx context.Context, tagid int) *PageIterator[string] {
+	return iterateOpenIDs(ctx, func(ctx context.Context, nextOpenID string) (FollowerPage, error) {
+		return c.GetTagUsersContext(ctx, tagid, nextOpenID)
+	})
+}
+
+func (c *WXClient) tagPost(ctx context.Context, uri string, data, v interface{}) error {
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	return c.httpPost(ctx, fmt.Sprintf(uri, token), data, v)
+}
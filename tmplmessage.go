@@ -2,10 +2,8 @@
 package wxdev
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
 )
 
 // TmplData 模板数据
@@ -56,30 +54,22 @@ const tmpl_message_url = "https://api.weixin.qq.com/cgi-bin/message/template/sen
 
 // SendTmplMessage 发送模板消息
 func (c *WXClient) SendTmplMessage(data *TmplData) (int64, error) {
-	token, err := c.getAccessToken()
+	return c.SendTmplMessageContext(context.Background(), data)
+}
+
+// SendTmplMessageContext 发送模板消息
+func (c *WXClient) SendTmplMessageContext(ctx context.Context, data *TmplData) (int64, error) {
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return 0, err
 	}
 	uri := fmt.Sprintf(tmpl_message_url, token)
-	var buf bytes.Buffer
-	err = json.NewEncoder(&buf).Encode(data)
-	if err != nil {
-		return 0, err
-	}
-	var res *http.Response
-	res, err = http.Post(uri, "application/json", &buf)
-	if res != nil {
-		defer res.Body.Close()
-	}
-	if err != nil {
-		return 0, err
-	}
 	var result TmplMessageSendReply
-	if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
+	if err = c.httpPost(ctx, uri, data, &result); err != nil {
 		return 0, err
 	}
 	if result.ErrCode != 0 {
-		return 0, fmt.Errorf("WXDev: Send template message failed, error code:%d, message:%s", result.ErrCode, result.ErrMsg)
+		return 0, NewAPIError(result.ErrCode, result.ErrMsg)
 	}
 	return result.MsgID, nil
 }
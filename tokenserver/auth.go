@@ -0,0 +1,131 @@
+// Token server 请求鉴权
+
+package tokenserver
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 请求签名使用的Header
+const (
+	HeaderClientID  = "X-WX-Client"
+	HeaderTimestamp = "X-WX-Timestamp"
+	HeaderNonce     = "X-WX-Nonce"
+	HeaderSignature = "X-WX-Signature"
+)
+
+// Sign 计算请求签名,
+// signature = hex(HMAC-SHA256(secret, clientID\ntimestamp\nnonce\nmethod\nrequestURI))
+func Sign(secret, clientID, timestamp, nonce, method, requestURI string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", clientID, timestamp, nonce, method, requestURI)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest 为访问Token server的请求添加签名Header
+func SignRequest(req *http.Request, clientID, secret string) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	b := make([]byte, 16)
+	rand.Read(b)
+	nonce := hex.EncodeToString(b)
+	req.Header.Set(HeaderClientID, clientID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, Sign(secret, clientID, timestamp, nonce, req.Method, req.URL.RequestURI()))
+}
+
+type authClient struct {
+	secret string
+	appids map[string]bool
+}
+
+// allow 是否允许访问指定APPID
+func (ac authClient) allow(appid string) bool {
+	return len(ac.appids) == 0 || ac.appids[appid]
+}
+
+// WithClient 注册访问客户端, 注册任意客户端后所有请求均需签名,
+// appids 为该客户端允许访问的APPID, 为空时允许访问全部APPID
+func WithClient(clientID, secret string, appids ...string) OptionFunc {
+	return func(s *Server) {
+		ac := authClient{secret: secret, appids: make(map[string]bool)}
+		for _, appid := range appids {
+			ac.appids[appid] = true
+		}
+		s.clients[clientID] = ac
+	}
+}
+
+// WithAuthWindow 设置签名时间戳的有效窗口, 默认5分钟
+func WithAuthWindow(window time.Duration) OptionFunc {
+	return func(s *Server) {
+		s.authWindow = window
+	}
+}
+
+// nonceCache 记录有效窗口内已使用的nonce, 防止重放
+type nonceCache struct {
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	sweep time.Time
+}
+
+// use 标记nonce已使用, nonce已存在时返回false
+func (nc *nonceCache) use(nonce string, window time.Duration) bool {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	now := time.Now()
+	if now.Sub(nc.sweep) > window {
+		for k, t := range nc.seen {
+			if now.Sub(t) > window*2 {
+				delete(nc.seen, k)
+			}
+		}
+		nc.sweep = now
+	}
+	if _, has := nc.seen[nonce]; has {
+		return false
+	}
+	nc.seen[nonce] = now
+	return true
+}
+
+// authenticate 校验请求签名及APPID访问权限
+func (s *Server) authenticate(r *http.Request, appid string) (int, error) {
+	if len(s.clients) == 0 {
+		return http.StatusOK, nil
+	}
+	clientID := r.Header.Get(HeaderClientID)
+	ac, has := s.clients[clientID]
+	if !has {
+		return http.StatusUnauthorized, fmt.Errorf("unknown client")
+	}
+	timestamp := r.Header.Get(HeaderTimestamp)
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return http.StatusUnauthorized, fmt.Errorf("invalid timestamp")
+	}
+	if d := time.Since(time.Unix(ts, 0)); d > s.authWindow || d < -s.authWindow {
+		return http.StatusUnauthorized, fmt.Errorf("timestamp expired")
+	}
+	nonce := r.Header.Get(HeaderNonce)
+	expect := Sign(ac.secret, clientID, timestamp, nonce, r.Method, r.URL.RequestURI())
+	if nonce == "" || !hmac.Equal([]byte(expect), []byte(r.Header.Get(HeaderSignature))) {
+		return http.StatusUnauthorized, fmt.Errorf("invalid signature")
+	}
+	if !s.nonces.use(clientID+":"+nonce, s.authWindow) {
+		return http.StatusUnauthorized, fmt.Errorf("nonce replayed")
+	}
+	if !ac.allow(appid) {
+		return http.StatusForbidden, fmt.Errorf("appid is not allowed")
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,113 @@
+package tokenserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID = "php-legacy"
+	testSecret   = "client-secret"
+)
+
+// newTestServer 创建注册了 appA/appB 的Token server, 客户端仅允许访问 appA
+func newTestServer(t *testing.T) http.Handler {
+	wx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"access_token":"token-%s","expires_in":7200}`, r.URL.Query().Get("appid"))
+	}))
+	t.Cleanup(wx.Close)
+	s := NewServer(WithBaseURL(wx.URL), WithClient(testClientID, testSecret, "appA"), WithAuthWindow(time.Minute))
+	s.Register("appA", "secretA")
+	s.Register("appB", "secretB")
+	return s.Handler()
+}
+
+func signedRequest(uri, clientID, secret string, ts time.Time, nonce string) *http.Request {
+	req := httptest.NewRequest("GET", uri, nil)
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	req.Header.Set(HeaderClientID, clientID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, Sign(secret, clientID, timestamp, nonce, req.Method, req.URL.RequestURI()))
+	return req
+}
+
+func serve(h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthenticateSignedRequest(t *testing.T) {
+	h := newTestServer(t)
+	req := httptest.NewRequest("GET", "/token?appid=appA", nil)
+	SignRequest(req, testClientID, testSecret)
+	w := serve(h, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+	}
+	var reply struct{ Token string }
+	if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil || reply.Token != "token-appA" {
+		t.Fatalf("reply = %s, error = %v", w.Body, err)
+	}
+}
+
+func TestAuthenticateRejects(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		req  *http.Request
+		code int
+	}{
+		{"unsigned", httptest.NewRequest("GET", "/token?appid=appA", nil), http.StatusUnauthorized},
+		{"unknown client", signedRequest("/token?appid=appA", "unknown", testSecret, now, "n1"), http.StatusUnauthorized},
+		{"wrong secret", signedRequest("/token?appid=appA", testClientID, "wrong", now, "n2"), http.StatusUnauthorized},
+		{"expired timestamp", signedRequest("/token?appid=appA", testClientID, testSecret, now.Add(-2*time.Minute), "n3"), http.StatusUnauthorized},
+		{"future timestamp", signedRequest("/token?appid=appA", testClientID, testSecret, now.Add(2*time.Minute), "n4"), http.StatusUnauthorized},
+		{"empty nonce", signedRequest("/token?appid=appA", testClientID, testSecret, now, ""), http.StatusUnauthorized},
+		{"appid not allowed", signedRequest("/token?appid=appB", testClientID, testSecret, now, "n5"), http.StatusForbidden},
+	}
+	h := newTestServer(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(h, tt.req); w.Code != tt.code {
+				t.Errorf("status = %d, want %d, body = %s", w.Code, tt.code, w.Body)
+			}
+		})
+	}
+}
+
+func TestAuthenticateTamperedURI(t *testing.T) {
+	h := newTestServer(t)
+	req := signedRequest("/token?appid=appA", testClientID, testSecret, time.Now(), "n1")
+	// 签名覆盖完整的请求地址, 修改参数后签名失效
+	req.URL.RawQuery = "appid=appA&refresh=1"
+	if w := serve(h, req); w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAuthenticateNonceReplay(t *testing.T) {
+	h := newTestServer(t)
+	now := time.Now()
+	if w := serve(h, signedRequest("/token?appid=appA", testClientID, testSecret, now, "once")); w.Code != http.StatusOK {
+		t.Fatalf("first request status = %d, body = %s", w.Code, w.Body)
+	}
+	w := serve(h, signedRequest("/token?appid=appA", testClientID, testSecret, now, "once"))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("replayed request status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAuthenticateWithoutClients(t *testing.T) {
+	s := NewServer()
+	req := httptest.NewRequest("GET", "/token?appid=appA", nil)
+	if code, err := s.authenticate(req, "appA"); err != nil || code != http.StatusOK {
+		t.Errorf("authenticate = %d, %v, want open access when no client is registered", code, err)
+	}
+}
@@ -3,21 +3,26 @@
 package tokenserver
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/golang/groupcache/singleflight"
 	"github.com/shengzhi/util/helper"
+	"github.com/shengzhi/wxdev/wxerr"
 )
 
 type tokenReply struct {
@@ -29,7 +34,7 @@ type tokenReply struct {
 
 func (r tokenReply) checkErr() error {
 	if r.ErrCode != 0 {
-		return fmt.Errorf("Code:%d,Message: %s", r.ErrCode, r.ErrMsg)
+		return wxerr.NewAPIError(int(r.ErrCode), r.ErrMsg)
 	}
 	return nil
 }
@@ -43,7 +48,7 @@ type ticketReply struct {
 
 func (r ticketReply) checkErr() error {
 	if r.ErrCode != 0 {
-		return fmt.Errorf("Code:%d,Message: %s", r.ErrCode, r.ErrMsg)
+		return wxerr.NewAPIError(r.ErrCode, r.ErrMsg)
 	}
 	return nil
 }
@@ -52,6 +57,8 @@ type app struct {
 	appid, secret string
 	token         tokenReply
 	expiredTime   time.Time
+	// stable 是否使用稳定版接口 stable_token 获取 access_token
+	stable bool
 }
 
 // isValid 是否有效
@@ -72,29 +79,123 @@ func (ta ticketApp) isValid() bool {
 
 // Server Token 中控服务
 type Server struct {
-	apps        map[string]app
-	ticketApps  map[string]ticketApp
-	flightGroup singleflight.Group
+	mu            sync.RWMutex
+	apps          map[string]app
+	ticketApps    map[string]ticketApp
+	flightGroup   singleflight.Group
+	store         TokenStore
+	refreshMargin time.Duration
+	clients       map[string]authClient
+	authWindow    time.Duration
+	nonces        nonceCache
+	httpcli       *http.Client
+	baseURL       string
+}
+
+// OptionFunc 配置函数
+type OptionFunc func(*Server)
+
+// WithTokenStore 设置Token存储, 默认为内存存储
+func WithTokenStore(store TokenStore) OptionFunc {
+	return func(s *Server) {
+		s.store = store
+	}
+}
+
+// WithHTTPClient 设置调用微信接口使用的HTTP客户端
+func WithHTTPClient(client *http.Client) OptionFunc {
+	return func(s *Server) {
+		s.httpcli = client
+	}
+}
+
+// WithBaseURL 设置微信接口地址, 默认为 https://api.weixin.qq.com, 用于测试环境或模拟服务
+func WithBaseURL(uri string) OptionFunc {
+	return func(s *Server) {
+		s.baseURL = strings.TrimSuffix(uri, "/")
+	}
+}
+
+// WithRefreshMargin 设置后台刷新提前量, 在token过期前margin时间内主动刷新, 默认5分钟
+func WithRefreshMargin(margin time.Duration) OptionFunc {
+	return func(s *Server) {
+		s.refreshMargin = margin
+	}
 }
 
 // NewServer 创建Server程序
-func NewServer() *Server {
-	return &Server{
-		apps:       make(map[string]app, 0),
-		ticketApps: make(map[string]ticketApp, 0),
+func NewServer(options ...OptionFunc) *Server {
+	s := &Server{
+		apps:          make(map[string]app, 0),
+		ticketApps:    make(map[string]ticketApp, 0),
+		store:         NewMemoryStore(),
+		refreshMargin: 5 * time.Minute,
+		clients:       make(map[string]authClient),
+		authWindow:    5 * time.Minute,
+		nonces:        nonceCache{seen: make(map[string]time.Time)},
+		httpcli:       &http.Client{},
+		baseURL:       "https://api.weixin.qq.com",
+	}
+	for _, fn := range options {
+		fn(s)
 	}
+	return s
 }
 
-// Register 注册微信APP账号
+func tokenKey(appid string) string  { return "access_token:" + appid }
+func ticketKey(appid string) string { return "jsapi_ticket:" + appid }
+
+// Register 注册微信APP账号, 并从存储中加载尚未过期的 access_token 及 jsapi_ticket
 func (s *Server) Register(appid, secret string) {
-	s.apps[appid] = app{
+	s.register(app{
 		appid: appid, secret: secret, token: tokenReply{},
+	})
+}
+
+// RegisterStable 注册微信APP账号, 使用 stable_token 接口获取稳定版 access_token,
+// 普通模式下获取token不会使其他调用方持有的token失效, 可与其他中控服务共存
+func (s *Server) RegisterStable(appid, secret string) {
+	s.register(app{
+		appid: appid, secret: secret, token: tokenReply{}, stable: true,
+	})
+}
+
+func (s *Server) register(a app) {
+	appid := a.appid
+	if token, expiredTime, err := s.store.Get(tokenKey(appid)); err == nil {
+		a.token.Token, a.expiredTime = token, expiredTime
+	} else if err != ErrTokenNotFound {
+		log.Printf("Load access_token of %s failed, error:%v\n", appid, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apps[appid] = a
+	if ticket, expiredTime, err := s.store.Get(ticketKey(appid)); err == nil {
+		ta := ticketApp{appid: appid, expiredTime: expiredTime}
+		ta.ticket.Ticket = ticket
+		s.ticketApps[appid] = ta
+	} else if err != ErrTokenNotFound {
+		log.Printf("Load jsapi_ticket of %s failed, error:%v\n", appid, err)
 	}
 }
 
+func (s *Server) getApp(appid string) (app, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, has := s.apps[appid]
+	return a, has
+}
+
+func (s *Server) getTicketApp(appid string) (ticketApp, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ta, has := s.ticketApps[appid]
+	return ta, has
+}
+
 // GetToken 获取Access Token
 func (s *Server) GetToken(appid string) (string, string, error) {
-	app, has := s.apps[appid]
+	app, has := s.getApp(appid)
 	if !has {
 		return "", "", fmt.Errorf("APPID is not registered")
 	}
@@ -102,30 +203,92 @@ func (s *Server) GetToken(appid string) (string, string, error) {
 	if app.isValid() {
 		return app.token.Token, app.expiredTime.Format("2006-01-02 15:04:05"), nil
 	}
-	token, err := s.flightGroup.Do(appid, func() (interface{}, error) {
+	return s.refreshToken(app, "")
+}
+
+// RefreshToken 强制刷新Access Token,
+// stale 为调用方已失效的token, 若与当前缓存的token不一致说明已被刷新过, 直接返回当前token.
+// stale 为空时无法确认token已失效, 等同于 GetToken, 避免调用方随意刷新耗尽每日调用次数.
+// 稳定版模式下先以普通模式调用 stable_token 接口, 仍返回stale时才使用 force_refresh=true
+func (s *Server) RefreshToken(appid, stale string) (string, string, error) {
+	if stale == "" {
+		return s.GetToken(appid)
+	}
+	app, has := s.getApp(appid)
+	if !has {
+		return "", "", fmt.Errorf("APPID is not registered")
+	}
+	if app.isValid() && app.token.Token != stale {
+		return app.token.Token, app.expiredTime.Format("2006-01-02 15:04:05"), nil
+	}
+	return s.refreshToken(app, stale)
+}
+
+// refreshToken 从微信获取新的token, stale 不为空时表示该token已失效需强制刷新
+func (s *Server) refreshToken(a app, stale string) (string, string, error) {
+	key := a.appid
+	if stale != "" {
+		key = "force_" + a.appid
+	}
+	resp, err := s.flightGroup.Do(key, func() (interface{}, error) {
 		var reply tokenReply
-		err := s.getAccessToken(app.appid, app.secret, &reply)
+		var err error
+		if a.stable {
+			// 其他调用方可能已刷新过token, 普通模式即可获取到新token, 无需消耗强制刷新次数
+			err = s.getStableAccessToken(a.appid, a.secret, false, &reply)
+			if err == nil && reply.checkErr() == nil && stale != "" && reply.Token == stale {
+				reply = tokenReply{}
+				err = s.getStableAccessToken(a.appid, a.secret, true, &reply)
+			}
+		} else {
+			err = s.getAccessToken(a.appid, a.secret, &reply)
+		}
 		if err != nil {
 			return nil, err
 		}
-		return reply, reply.checkErr()
+		if err = reply.checkErr(); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		a = s.apps[a.appid]
+		a.token = reply
+		a.expiredTime = time.Now().Add(time.Second * time.Duration(reply.Expires))
+		s.apps[a.appid] = a
+		s.mu.Unlock()
+		if err = s.store.Set(tokenKey(a.appid), a.token.Token, a.expiredTime); err != nil {
+			log.Printf("Save access_token of %s failed, error:%v\n", a.appid, err)
+		}
+		return a, nil
 	})
 	if err != nil {
 		return "", "", err
 	}
-	app = s.apps[appid]
-	if app.isValid() {
-		return app.token.Token, app.expiredTime.Format("2006-01-02 15:04:05"), nil
-	}
-	app.token = token.(tokenReply)
-	app.expiredTime = time.Now().Add(time.Second * time.Duration(app.token.Expires))
-	s.apps[app.appid] = app
-	return app.token.Token, app.expiredTime.Format("2006-01-02 15:04:05"), nil
+	a = resp.(app)
+	return a.token.Token, a.expiredTime.Format("2006-01-02 15:04:05"), nil
 }
 
 func (s *Server) getAccessToken(appid, secret string, v interface{}) error {
-	uri := "https://api.weixin.qq.com/cgi-bin/token?grant_type=client_credential&appid=%s&secret=%s"
-	res, err := http.Get(fmt.Sprintf(uri, appid, secret))
+	const uri = "%s/cgi-bin/token?grant_type=client_credential&appid=%s&secret=%s"
+	res, err := s.httpcli.Get(fmt.Sprintf(uri, s.baseURL, appid, secret))
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// getStableAccessToken 获取稳定版 access_token, forceRefresh 为true时强制刷新
+func (s *Server) getStableAccessToken(appid, secret string, forceRefresh bool, v interface{}) error {
+	uri := s.baseURL + "/cgi-bin/stable_token"
+	body, _ := json.Marshal(map[string]interface{}{
+		"grant_type":    "client_credential",
+		"appid":         appid,
+		"secret":        secret,
+		"force_refresh": forceRefresh,
+	})
+	res, err := s.httpcli.Post(uri, "application/json", bytes.NewReader(body))
 	if res != nil {
 		defer res.Body.Close()
 	}
@@ -137,35 +300,110 @@ func (s *Server) getAccessToken(appid, secret string, v interface{}) error {
 
 // GetJSAPITicket 获取微信JSAPI_Ticket
 func (s *Server) GetJSAPITicket(appid string) (string, string, error) {
-	app, has := s.ticketApps[appid]
+	app, has := s.getTicketApp(appid)
 	if has && app.isValid() {
 		return app.ticket.Ticket, app.expiredTime.Format("2006-01-02 15:04:05"), nil
 	}
+	return s.refreshTicket(appid)
+}
+
+func (s *Server) refreshTicket(appid string) (string, string, error) {
 	key := fmt.Sprintf("ticket_%s", appid)
 	resp, err := s.flightGroup.Do(key, func() (interface{}, error) {
-		var reply ticketReply
-		err := s.doGetTicket(appid, &reply)
-		return reply, err
+		reply, err := s.doGetTicket(appid)
+		if err != nil {
+			return nil, err
+		}
+		if err = reply.checkErr(); err != nil {
+			return nil, err
+		}
+		ta := ticketApp{appid: appid, ticket: reply}
+		ta.expiredTime = time.Now().Add(time.Second * time.Duration(reply.Expires))
+		s.mu.Lock()
+		s.ticketApps[appid] = ta
+		s.mu.Unlock()
+		if err = s.store.Set(ticketKey(appid), ta.ticket.Ticket, ta.expiredTime); err != nil {
+			log.Printf("Save jsapi_ticket of %s failed, error:%v\n", appid, err)
+		}
+		return ta, nil
 	})
 	if err != nil {
 		return "", "", err
 	}
-	app = ticketApp{appid: appid, ticket: resp.(ticketReply)}
-	if err = app.ticket.checkErr(); err != nil {
-		return "", "", err
+	ta := resp.(ticketApp)
+	return ta.ticket.Ticket, ta.expiredTime.Format("2006-01-02 15:04:05"), nil
+}
+
+// RunRefresher 后台刷新, 在 access_token 及 jsapi_ticket 过期前主动刷新, 直至ctx结束
+func (s *Server) RunRefresher(ctx context.Context) {
+	interval := s.refreshMargin / 5
+	if interval <= 0 || interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.refreshExpiring()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshExpiring 刷新即将过期的 access_token 及 jsapi_ticket
+func (s *Server) refreshExpiring() {
+	deadline := time.Now().Add(s.refreshMargin)
+	var apps []app
+	var tickets []string
+	s.mu.RLock()
+	for _, a := range s.apps {
+		if a.expiredTime.Before(deadline) {
+			apps = append(apps, a)
+		}
+	}
+	for appid, ta := range s.ticketApps {
+		if ta.expiredTime.Before(deadline) {
+			tickets = append(tickets, appid)
+		}
+	}
+	s.mu.RUnlock()
+	for _, a := range apps {
+		if _, _, err := s.refreshToken(a, ""); err != nil {
+			log.Printf("Refresh access_token of %s failed, error:%v\n", a.appid, err)
+		}
+	}
+	for _, appid := range tickets {
+		if _, _, err := s.refreshTicket(appid); err != nil {
+			log.Printf("Refresh jsapi_ticket of %s failed, error:%v\n", appid, err)
+		}
 	}
-	app.expiredTime = time.Now().Add(time.Second * time.Duration(app.ticket.Expires))
-	s.ticketApps[appid] = app
-	return app.ticket.Ticket, app.expiredTime.Format("2006-01-02 15:04:05"), nil
 }
 
-func (s *Server) doGetTicket(appid string, v interface{}) error {
+func (s *Server) doGetTicket(appid string) (ticketReply, error) {
+	var reply ticketReply
 	token, _, err := s.GetToken(appid)
 	if err != nil {
-		return err
+		return reply, err
+	}
+	if err = s.requestTicket(token, &reply); err != nil {
+		return reply, err
 	}
-	const uri = "https://api.weixin.qq.com/cgi-bin/ticket/getticket?access_token=%s&type=jsapi"
-	res, err := http.Get(fmt.Sprintf(uri, token))
+	// access_token 失效时强制刷新后重试一次
+	if wxerr.IsTokenExpiredCode(reply.ErrCode) {
+		if token, _, err = s.RefreshToken(appid, token); err != nil {
+			return reply, err
+		}
+		reply = ticketReply{}
+		err = s.requestTicket(token, &reply)
+	}
+	return reply, err
+}
+
+func (s *Server) requestTicket(token string, v interface{}) error {
+	const uri = "%s/cgi-bin/ticket/getticket?access_token=%s&type=jsapi"
+	res, err := s.httpcli.Get(fmt.Sprintf(uri, s.baseURL, token))
 	if res != nil {
 		defer res.Body.Close()
 	}
@@ -200,59 +438,105 @@ func (s *Server) GenJSAPISign(appid, uri string) (JSSDKSignature, error) {
 	return JSSDKSignature{AppID: appid, Noncestr: noncestr, Timestamp: timestamp, Sign: sign}, nil
 }
 
-// Run 启动server 并监听HTTP端口
-func (s *Server) Run(port int) {
-	stop := make(chan os.Signal)
-	signal.Notify(stop, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	http.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+// authorize 校验请求, 未通过时返回错误信息
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, appid string) bool {
+	code, err := s.authenticate(r, appid)
+	if err == nil {
+		return true
+	}
+	log.Printf("Reject request from %s, error:%v\n", r.RemoteAddr, err)
+	w.Header().Set("Content-Type", "text/json")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"errcode":%d,"errmsg":%q}`, code, err.Error())
+	return false
+}
+
+// writeError 返回错误信息, 微信接口的错误码及错误信息原样透传, 其他错误使用500
+func writeError(w http.ResponseWriter, err error) {
+	code, msg := 500, err.Error()
+	var apiErr *wxerr.APIError
+	if errors.As(err, &apiErr) {
+		code, msg = apiErr.Code, apiErr.Msg
+	}
+	fmt.Fprintf(w, `{"errcode":%d,"errmsg":%q}`, code, msg)
+}
+
+// Handler 返回提供 /token, /jsapiticket 及 /jssdkconfig 接口的 http.Handler
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
 		appid := r.URL.Query().Get("appid")
 		if appid == "" {
 			w.WriteHeader(400)
 			return
 		}
-		token, expired, err := s.GetToken(appid)
+		if !s.authorize(w, r, appid) {
+			return
+		}
+		var token, expired string
+		var err error
+		if r.URL.Query().Get("refresh") == "1" {
+			token, expired, err = s.RefreshToken(appid, r.URL.Query().Get("stale"))
+		} else {
+			token, expired, err = s.GetToken(appid)
+		}
+		w.Header().Set("Content-Type", "text/json")
 		if err != nil {
 			log.Println(err)
-			fmt.Fprintf(w, `{"errcode":%d,"errmsg":%v}`, 500, err)
+			writeError(w, err)
 		} else {
 			fmt.Fprintf(w, `{"token":"%s","expired":"%s"}`, token, expired)
 		}
-		w.Header().Set("Content-Type", "text/json")
 	})
-	http.HandleFunc("/jsapiticket", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/jsapiticket", func(w http.ResponseWriter, r *http.Request) {
 		appid := r.URL.Query().Get("appid")
 		if appid == "" {
 			w.WriteHeader(400)
 			return
 		}
+		if !s.authorize(w, r, appid) {
+			return
+		}
 		ticket, expired, err := s.GetJSAPITicket(appid)
+		w.Header().Set("Content-Type", "text/json")
 		if err != nil {
-			fmt.Fprintf(w, `{"errcode":%d,"errmsg":%v}`, 500, err)
+			writeError(w, err)
 		} else {
 			fmt.Fprintf(w, `{"ticket":"%s","expired":"%s"}`, ticket, expired)
 		}
-		w.Header().Set("Content-Type", "text/json")
 	})
-
-	http.HandleFunc("/jssdkconfig", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/jssdkconfig", func(w http.ResponseWriter, r *http.Request) {
 		appid := r.URL.Query().Get("appid")
 		if appid == "" {
 			w.WriteHeader(400)
 			return
 		}
+		if !s.authorize(w, r, appid) {
+			return
+		}
 		uri := r.URL.Query().Get("uri")
 		uri, _ = url.QueryUnescape(uri)
 		cfg, err := s.GenJSAPISign(appid, uri)
+		w.Header().Set("Content-Type", "text/json")
 		if err != nil {
-			fmt.Fprintf(w, `{"errcode":%d,"errmsg":%v}`, 500, err)
+			writeError(w, err)
 		} else {
 			data := fmt.Sprintf(`{"appid":"%s","noncestr":"%s","timestamp":%d,"sign":"%s"}`, cfg.AppID, cfg.Noncestr, cfg.Timestamp, cfg.Sign)
 			fmt.Fprint(w, data)
 		}
-		w.Header().Set("Content-Type", "text/json")
 	})
+	return mux
+}
+
+// Run 启动server 并监听HTTP端口
+func (s *Server) Run(port int) {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.RunRefresher(ctx)
 
-	httpServer := http.Server{Addr: fmt.Sprintf(":%d", port)}
+	httpServer := http.Server{Addr: fmt.Sprintf(":%d", port), Handler: s.Handler()}
 	go func() {
 		if err := httpServer.ListenAndServe(); err != nil {
 			if err != http.ErrServerClosed {
@@ -0,0 +1,121 @@
+// Token 持久化存储
+
+package tokenserver
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrTokenNotFound token 不存在
+var ErrTokenNotFound = errors.New("token not found")
+
+// TokenStore Token 存储, 用于在重启后恢复尚未过期的 access_token 及 jsapi_ticket
+type TokenStore interface {
+	// Get 读取token及其过期时间, 不存在时返回 ErrTokenNotFound
+	Get(key string) (string, time.Time, error)
+	// Set 保存token及其过期时间
+	Set(key, value string, expiredTime time.Time) error
+}
+
+type storeItem struct {
+	Value       string    `json:"value"`
+	ExpiredTime time.Time `json:"expired_time"`
+}
+
+// MemoryStore 内存存储
+type MemoryStore struct {
+	mu    sync.RWMutex
+	items map[string]storeItem
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: make(map[string]storeItem)}
+}
+
+// Get 读取token
+func (m *MemoryStore) Get(key string) (string, time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	item, has := m.items[key]
+	if !has {
+		return "", time.Time{}, ErrTokenNotFound
+	}
+	return item.Value, item.ExpiredTime, nil
+}
+
+// Set 保存token
+func (m *MemoryStore) Set(key, value string, expiredTime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[key] = storeItem{Value: value, ExpiredTime: expiredTime}
+	return nil
+}
+
+// FileStore 基于JSON文件的存储, 每次写入都会完整落盘
+type FileStore struct {
+	path  string
+	mu    sync.RWMutex
+	items map[string]storeItem
+}
+
+// NewFileStore 创建文件存储, 文件存在时加载已有数据
+func NewFileStore(path string) (*FileStore, error) {
+	fs := &FileStore{path: path, items: make(map[string]storeItem)}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fs, nil
+		}
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &fs.items); err != nil {
+			return nil, err
+		}
+	}
+	return fs, nil
+}
+
+// Get 读取token
+func (fs *FileStore) Get(key string) (string, time.Time, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	item, has := fs.items[key]
+	if !has {
+		return "", time.Time{}, ErrTokenNotFound
+	}
+	return item.Value, item.ExpiredTime, nil
+}
+
+// Set 保存token并写入文件
+func (fs *FileStore) Set(key, value string, expiredTime time.Time) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.items[key] = storeItem{Value: value, ExpiredTime: expiredTime}
+	data, err := json.MarshalIndent(fs.items, "", "  ")
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再重命名, 避免进程中断导致文件损坏
+	tmp, err := ioutil.TempFile(filepath.Dir(fs.path), filepath.Base(fs.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), fs.path)
+}
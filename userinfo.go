@@ -1,6 +1,7 @@
 package wxdev
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/shengzhi/util/dtime"
@@ -53,28 +54,38 @@ type WXUserInfo struct {
 
 // GetUserInfo 获取用户基本信息
 func (c *WXClient) GetUserInfo(openid string) (user WXUserInfo, err error) {
+	return c.GetUserInfoContext(context.Background(), openid)
+}
+
+// GetUserInfoContext 获取用户基本信息
+func (c *WXClient) GetUserInfoContext(ctx context.Context, openid string) (user WXUserInfo, err error) {
 	const uri = "https://api.weixin.qq.com/cgi-bin/user/info?access_token=%s&openid=%s&lang=zh_CN"
-	token, err := c.getAccessToken()
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return user, err
 	}
-	err = c.httpGet(fmt.Sprintf(uri, token, openid), &user)
+	err = c.httpGet(ctx, fmt.Sprintf(uri, token, openid), &user)
 	if err != nil {
 		return
 	}
 	if user.ErrCode != 0 {
-		err = fmt.Errorf("%d-%s", user.ErrCode, user.ErrMsg)
+		err = NewAPIError(user.ErrCode, user.ErrMsg)
 	}
 	return
 }
 
 // BatchGetUserInfo 批量获取用户信息
 func (c *WXClient) BatchGetUserInfo(openids ...string) ([]WXUserInfo, error) {
+	return c.BatchGetUserInfoContext(context.Background(), openids...)
+}
+
+// BatchGetUserInfoContext 批量获取用户信息
+func (c *WXClient) BatchGetUserInfoContext(ctx context.Context, openids ...string) ([]WXUserInfo, error) {
 	if len(openids) <= 0 || len(openids) > 100 {
 		return nil, fmt.Errorf("Cannot be more than 100 records one time")
 	}
 	const uri = "https://api.weixin.qq.com/cgi-bin/user/info/batchget?access_token=%s"
-	token, err := c.getAccessToken()
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -93,16 +104,112 @@ func (c *WXClient) BatchGetUserInfo(openids ...string) ([]WXUserInfo, error) {
 		ErrMsg  string       `json:"errmsg"`
 		Users   []WXUserInfo `json:"user_info_list"`
 	}
-	err = c.httpPost(fmt.Sprintf(uri, token), data, &result)
+	err = c.httpPost(ctx, fmt.Sprintf(uri, token), data, &result)
 	if err != nil {
 		return nil, err
 	}
 	if result.ErrCode != 0 {
-		return nil, fmt.Errorf("%d-%s", result.ErrCode, result.ErrMsg)
+		return nil, NewAPIError(result.ErrCode, result.ErrMsg)
 	}
 	return result.Users, nil
 }
 
+// UpdateUserRemark 设置用户备注名, 备注名长度必须小于30字符
+func (c *WXClient) UpdateUserRemark(openid, remark string) error {
+	return c.UpdateUserRemarkContext(context.Background(), openid, remark)
+}
+
+// UpdateUserRemarkContext 设置用户备注名, 备注名长度必须小于30字符
+func (c *WXClient) UpdateUserRemarkContext(ctx context.Context, openid, remark string) error {
+	const uri = "https://api.weixin.qq.com/cgi-bin/user/info/updateremark?access_token=%s"
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	var result apiReply
+	err = c.httpPost(ctx, fmt.Sprintf(uri, token), map[string]string{"openid": openid, "remark": remark}, &result)
+	if err != nil {
+		return err
+	}
+	return result.Error()
+}
+
+// GetBlacklist 获取黑名单列表, beginOpenID 为空时从头开始拉取, 每页最多10000个
+func (c *WXClient) GetBlacklist(beginOpenID string) (FollowerPage, error) {
+	return c.GetBlacklistContext(context.Background(), beginOpenID)
+}
+
+// GetBlacklistContext 获取黑名单列表, beginOpenID 为空时从头开始拉取, 每页最多10000个
+func (c *WXClient) GetBlacklistContext(ctx context.Context, beginOpenID string) (FollowerPage, error) {
+	const uri = "https://api.weixin.qq.com/cgi-bin/tags/members/getblacklist?access_token=%s"
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return FollowerPage{}, err
+	}
+	var result struct {
+		apiReply
+		Total int `json:"total"`
+		Count int `json:"count"`
+		Data  struct {
+			OpenIDs []string `json:"openid"`
+		} `json:"data"`
+		NextOpenID string `json:"next_openid"`
+	}
+	err = c.httpPost(ctx, fmt.Sprintf(uri, token), map[string]string{"begin_openid": beginOpenID}, &result)
+	if err != nil {
+		return FollowerPage{}, err
+	}
+	if err = result.Error(); err != nil {
+		return FollowerPage{}, err
+	}
+	return FollowerPage{Total: result.Total, OpenIDs: result.Data.OpenIDs, NextID: result.NextOpenID}, nil
+}
+
+// ListBlacklist 按begin_openid分页遍历黑名单
+func (c *WXClient) ListBlacklist(ctx context.Context) *PageIterator[string] {
+	return iterateOpenIDs(ctx, c.GetBlacklistContext)
+}
+
+// BatchBlacklist 拉黑用户, 每次最多50个openid
+func (c *WXClient) BatchBlacklist(openids ...string) error {
+	return c.BatchBlacklistContext(context.Background(), openids...)
+}
+
+// BatchBlacklistContext 拉黑用户, 每次最多50个openid
+func (c *WXClient) BatchBlacklistContext(ctx context.Context, openids ...string) error {
+	const uri = "https://api.weixin.qq.com/cgi-bin/tags/members/batchblacklist?access_token=%s"
+	return c.batchBlacklist(ctx, uri, openids)
+}
+
+// BatchUnblacklist 取消拉黑用户, 每次最多50个openid
+func (c *WXClient) BatchUnblacklist(openids ...string) error {
+	return c.BatchUnblacklistContext(context.Background(), openids...)
+}
+
+// BatchUnblacklistContext 取消拉黑用户, 每次最多50个openid
+func (c *WXClient) BatchUnblacklistContext(ctx context.Context, openids ...string) error {
+	const uri = "https://api.weixin.qq.com/cgi-bin/tags/members/batchunblacklist?access_token=%s"
+	return c.batchBlacklist(ctx, uri, openids)
+}
+
+func (c *WXClient) batchBlacklist(ctx context.Context, uri string, openids []string) error {
+	if len(openids) <= 0 || len(openids) > 50 {
+		return fmt.Errorf("Cannot be more than 50 records one time")
+	}
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	data := struct {
+		OpenIDs []string `json:"openid_list"`
+	}{openids}
+	var result apiReply
+	if err = c.httpPost(ctx, fmt.Sprintf(uri, token), data, &result); err != nil {
+		return err
+	}
+	return result.Error()
+}
+
 type LoginAccessToken struct {
 	ErrCode        int    `json:"errcode"`
 	ErrMsg         string `json:"errmsg"`
@@ -115,15 +222,21 @@ type LoginAccessToken struct {
 	IsSnapshotUser int    `json:"is_snapshotuser"`
 }
 
+// GetLoginAccessToken 通过网页授权code换取access_token
 func (c *WXClient) GetLoginAccessToken(code string) (LoginAccessToken, error) {
+	return c.GetLoginAccessTokenContext(context.Background(), code)
+}
+
+// GetLoginAccessTokenContext 通过网页授权code换取access_token
+func (c *WXClient) GetLoginAccessTokenContext(ctx context.Context, code string) (LoginAccessToken, error) {
 	const uri = "https://api.weixin.qq.com/sns/oauth2/access_token?appid=%s&secret=%s&code=%s&grant_type=authorization_code"
 	var token LoginAccessToken
-	err := c.httpGet(fmt.Sprintf(uri, c.appid, c.appsecret, code), &token)
+	err := c.httpGet(ctx, fmt.Sprintf(uri, c.appid, c.appsecret, code), &token)
 	if err != nil {
 		return token, err
 	}
 	if token.ErrCode != 0 {
-		return token, fmt.Errorf("code:%d,message:%s", token.ErrCode, token.ErrMsg)
+		return token, NewAPIError(token.ErrCode, token.ErrMsg)
 	}
 	return token, nil
 }
@@ -1,25 +1,29 @@
 package wxdev
 
 import (
-	"bytes"
+	"context"
 	"crypto/sha1"
-	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
 	"time"
 
 	"github.com/golang/groupcache/singleflight"
 	"github.com/shengzhi/util/helper"
+	"github.com/shengzhi/wxdev/crypt"
+	"github.com/shengzhi/wxdev/internal/wxhttp"
+	"github.com/shengzhi/wxdev/tokenserver"
 )
 
 var ErrNoTokenServer = errors.New("No specify token server")
 
+// ErrEmptyToken Token server 未返回access_token
+var ErrEmptyToken = errors.New("Token server returned empty access_token")
+
 type AccessTokenFunc func(appid string) (string, error)
 
 // OptionFunc 配置函数
@@ -36,6 +40,13 @@ func WithTokenServer(uri string) OptionFunc {
 	}
 }
 
+// WithTokenServerAuth 设置访问Token server的客户端ID及签名密钥
+func WithTokenServerAuth(clientID, secret string) OptionFunc {
+	return func(c *WXClient) {
+		c.tokenClientID, c.tokenClientSecret = clientID, secret
+	}
+}
+
 func WithValidationToken(token string) OptionFunc {
 	return func(c *WXClient) {
 		c.validationToken = token
@@ -48,33 +59,98 @@ func WithAccessTokenFn(fn AccessTokenFunc) OptionFunc {
 	}
 }
 
+// WithRefreshTokenFn 设置强制刷新access_token的函数, 接口返回access_token失效时调用
+func WithRefreshTokenFn(fn AccessTokenFunc) OptionFunc {
+	return func(c *WXClient) {
+		c.fnRefreshToken = fn
+	}
+}
+
 func WithAppSecret(secret string) OptionFunc { return func(w *WXClient) { w.appsecret = secret } }
 
+// WithHTTPClient 设置调用微信接口及Token server使用的HTTP客户端
+func WithHTTPClient(client *http.Client) OptionFunc {
+	return func(c *WXClient) {
+		c.api.HTTPClient = client
+	}
+}
+
+// WithTransport 设置HTTP客户端的Transport, 可用于配置代理、链路追踪等
+func WithTransport(rt http.RoundTripper) OptionFunc {
+	return func(c *WXClient) {
+		client := *c.api.HTTPClient
+		client.Transport = rt
+		c.api.HTTPClient = &client
+	}
+}
+
+// WithBaseURL 将所有微信接口域名(api/file.api/mp.weixin.qq.com)替换为指定地址, 用于测试环境或模拟服务
+func WithBaseURL(uri string) OptionFunc {
+	return func(c *WXClient) {
+		var err error
+		c.api.BaseURL, err = url.Parse(uri)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+}
+
+// WithDedup 启用消息排重, 微信重试推送的消息在ttl内不会重复调用处理器.
+// store 为nil时使用容量为10000的LRU内存存储, ttl<=0时默认为1分钟
+func WithDedup(store DedupStore, ttl time.Duration) OptionFunc {
+	return func(c *WXClient) {
+		if store == nil {
+			store = NewLRUDedupStore(10000)
+		}
+		if ttl <= 0 {
+			ttl = time.Minute
+		}
+		c.dedupStore, c.dedupTTL = store, ttl
+	}
+}
+
+// WithEncodingAESKey 设置消息加解密密钥, 启用安全模式, 此后将拒绝未加密的消息推送
+func WithEncodingAESKey(encodingAESKey string) OptionFunc {
+	return func(c *WXClient) {
+		var err error
+		c.aesKey, err = crypt.DecodeAESKey(encodingAESKey)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+}
+
 // WXClient 公众号客户端
 type WXClient struct {
-	appid, appsecret string
-	tokenServerURL   *url.URL
-	jsapiTicket      struct {
+	appid, appsecret  string
+	tokenServerURL    *url.URL
+	tokenClientID     string
+	tokenClientSecret string
+	jsapiTicket       struct {
 		ticket      string
 		expiredTime time.Time
 	}
 	validationToken string
+	aesKey          []byte
 	msgHandler      WXMessageHandler
+	dedupStore      DedupStore
+	dedupTTL        time.Duration
+	async           *asyncPool
 	flightG         singleflight.Group
 	fnAccessToken   AccessTokenFunc
-	client          *http.Client
-	isdebug         bool
+	fnRefreshToken  AccessTokenFunc
+	api             wxhttp.Client
 }
 
 // NewWXClient 创建公众号客户端
 func NewWXClient(appid string, options ...OptionFunc) *WXClient {
-	c := &WXClient{appid: appid,
-		client: &http.Client{
-			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
-		}}
+	c := &WXClient{appid: appid}
+	c.api.HTTPClient = &http.Client{}
 	for _, fn := range options {
 		fn(c)
 	}
+	c.api.Refresh = c.refreshAccessToken
+	c.api.SignRequest = c.signTokenRequest
 	return c
 }
 
@@ -83,57 +159,21 @@ func (c *WXClient) APPID() string { return c.appid }
 
 // EnableDebug 启用debug模式
 func (c *WXClient) EnableDebug() {
-	c.isdebug = true
-}
-func (c *WXClient) dumpRequest(req *http.Request) {
-	if c.isdebug {
-		data, _ := httputil.DumpRequest(req, true)
-		fmt.Println(string(data))
-	}
-}
-func (c *WXClient) dumpResponse(resp *http.Response) {
-	if c.isdebug {
-		data, _ := httputil.DumpResponse(resp, true)
-		fmt.Println(string(data))
-	}
-}
-func (c *WXClient) httpDo(req *http.Request) (*http.Response, error) {
-	c.dumpRequest(req)
-	resp, err := c.client.Do(req)
-	c.dumpResponse(resp)
-	return resp, err
+	c.api.Debug = true
 }
 
-func (c *WXClient) httpGet(uri string, v interface{}) error {
-	req, err := http.NewRequest("GET", uri, nil)
-	if err != nil {
-		return err
-	}
-	res, err := c.httpDo(req)
-	if res != nil {
-		defer res.Body.Close()
-	}
-	if err != nil {
-		return err
-	}
-	return json.NewDecoder(res.Body).Decode(v)
+func (c *WXClient) httpGet(ctx context.Context, uri string, v interface{}) error {
+	return c.callAPI(ctx, "GET", uri, nil, "", v)
 }
 
-func (c *WXClient) httpPost(uri string, data, v interface{}) error {
+func (c *WXClient) httpPost(ctx context.Context, uri string, data, v interface{}) error {
 	body, _ := json.Marshal(data)
-	req, err := http.NewRequest("POST", uri, bytes.NewBuffer(body))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	res, err := c.httpDo(req)
-	if res != nil {
-		defer res.Body.Close()
-	}
-	if err != nil {
-		return err
-	}
-	return json.NewDecoder(res.Body).Decode(v)
+	return c.callAPI(ctx, "POST", uri, body, "application/json", v)
+}
+
+// callAPI 调用接口并解析JSON结果, access_token失效时强制刷新并重试一次
+func (c *WXClient) callAPI(ctx context.Context, method, uri string, body []byte, contentType string, v interface{}) error {
+	return c.api.Call(ctx, method, uri, body, contentType, v)
 }
 
 // JSSDKSignature JSSDK 签名对象
@@ -146,7 +186,12 @@ var randomeGenerator = helper.CreateRandomGenerator(helper.DigitsAndLetters)
 
 // GenJSAPISign 生成JSSDK签名
 func (c *WXClient) GenJSAPISign(u *url.URL) (JSSDKSignature, error) {
-	ticket, err := c.jsapitkt()
+	return c.GenJSAPISignContext(context.Background(), u)
+}
+
+// GenJSAPISignContext 生成JSSDK签名
+func (c *WXClient) GenJSAPISignContext(ctx context.Context, u *url.URL) (JSSDKSignature, error) {
+	ticket, err := c.jsapitkt(ctx)
 	if err != nil {
 		return JSSDKSignature{}, err
 	}
@@ -166,13 +211,13 @@ type wxreply struct {
 	Ticket, Expired string
 }
 
-func (c *WXClient) jsapitkt() (string, error) {
+func (c *WXClient) jsapitkt(ctx context.Context) (string, error) {
 	if time.Now().Before(c.jsapiTicket.expiredTime) {
 		return c.jsapiTicket.ticket, nil
 	}
 	resp, err := c.flightG.Do("getjsapiticket", func() (interface{}, error) {
 		var result wxreply
-		err := c.getJSAPITicket(&result)
+		err := c.getJSAPITicket(ctx, &result)
 		return result, err
 	})
 	if err != nil {
@@ -184,15 +229,15 @@ func (c *WXClient) jsapitkt() (string, error) {
 	return c.jsapiTicket.ticket, nil
 }
 
-func (c *WXClient) getJSAPITicket(v interface{}) error {
+func (c *WXClient) getJSAPITicket(ctx context.Context, v interface{}) error {
 	if c.tokenServerURL == nil {
 		return ErrNoTokenServer
 	}
 	u, _ := url.Parse(fmt.Sprintf("jsapiticket?appid=%s", c.appid))
-	return c.httpGet(c.tokenServerURL.ResolveReference(u).String(), v)
+	return c.tokenServerGet(ctx, c.tokenServerURL.ResolveReference(u).String(), v)
 }
 
-func (c *WXClient) getAccessToken() (string, error) {
+func (c *WXClient) getAccessToken(ctx context.Context) (string, error) {
 	if c.fnAccessToken != nil {
 		return c.fnAccessToken(c.appid)
 	}
@@ -200,20 +245,64 @@ func (c *WXClient) getAccessToken() (string, error) {
 		return "", ErrNoTokenServer
 	}
 	var err error
-	var token string
+	var resp interface{}
 	for i := 0; i < 5; i++ {
-		resp, err := c.flightG.Do("getaccesstoken", func() (interface{}, error) {
+		resp, err = c.flightG.Do("getaccesstoken", func() (interface{}, error) {
 			u, _ := url.Parse(fmt.Sprintf("token?appid=%s", c.appid))
 			var reply struct{ Token string }
-			err := c.httpGet(c.tokenServerURL.ResolveReference(u).String(), &reply)
+			err := c.tokenServerGet(ctx, c.tokenServerURL.ResolveReference(u).String(), &reply)
+			if err == nil && reply.Token == "" {
+				err = ErrEmptyToken
+			}
 			return reply.Token, err
 		})
-		if err != nil {
-			time.Sleep(time.Second)
-			continue
+		if err == nil {
+			return resp.(string), nil
+		}
+		// 微信返回的错误(如IP不在白名单)重试无意义
+		if ErrCode(err) != 0 {
+			return "", err
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Second):
 		}
-		token = resp.(string)
-		break
 	}
-	return token, err
+	return "", err
+}
+
+// refreshAccessToken 强制刷新access_token, stale为已失效的token
+func (c *WXClient) refreshAccessToken(ctx context.Context, stale string) (string, error) {
+	if c.fnRefreshToken != nil {
+		return c.fnRefreshToken(c.appid)
+	}
+	if c.tokenServerURL == nil {
+		return "", ErrNoTokenServer
+	}
+	resp, err := c.flightG.Do("refreshaccesstoken", func() (interface{}, error) {
+		u, _ := url.Parse(fmt.Sprintf("token?appid=%s&refresh=1&stale=%s", c.appid, url.QueryEscape(stale)))
+		var reply struct{ Token string }
+		err := c.tokenServerGet(ctx, c.tokenServerURL.ResolveReference(u).String(), &reply)
+		if err == nil && reply.Token == "" {
+			err = ErrEmptyToken
+		}
+		return reply.Token, err
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.(string), nil
+}
+
+// tokenServerGet 请求Token server
+func (c *WXClient) tokenServerGet(ctx context.Context, uri string, v interface{}) error {
+	return c.api.TokenServerGet(ctx, uri, v)
+}
+
+// signTokenRequest 配置了鉴权信息时对Token server请求签名
+func (c *WXClient) signTokenRequest(req *http.Request) {
+	if c.tokenClientID != "" {
+		tokenserver.SignRequest(req, c.tokenClientID, c.tokenClientSecret)
+	}
 }
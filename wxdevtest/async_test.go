@@ -0,0 +1,108 @@
+package wxdevtest
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/shengzhi/wxdev"
+)
+
+// csTexts 返回通过客服消息接口下发的文本消息, 按接收者分组
+func csTexts(t *testing.T, srv *Server) map[string]string {
+	t.Helper()
+	texts := make(map[string]string)
+	for _, r := range srv.Requests("/cgi-bin/message/custom/send") {
+		var msg struct {
+			ToUser  string `json:"touser"`
+			MsgType string `json:"msgtype"`
+			Text    struct {
+				Content string `json:"content"`
+			} `json:"text"`
+		}
+		if err := r.JSON(&msg); err != nil || msg.MsgType != "text" {
+			t.Fatalf("custom message = %s, error = %v", r.Body, err)
+		}
+		texts[msg.ToUser] = msg.Text.Content
+	}
+	return texts
+}
+
+func TestAsyncHandlerQueueFull(t *testing.T) {
+	srv, c := newTestClient(t, wxdev.WithValidationToken("push-token"), wxdev.WithAsyncHandler(1, 1))
+	started, release := make(chan struct{}), make(chan struct{})
+	var mu sync.Mutex
+	var handled []string
+	c.MessageHandleFunc(func(req wxdev.WXMessageRequest) wxdev.WXMessageResponse {
+		if req.Content == "block" {
+			close(started)
+			<-release
+		}
+		mu.Lock()
+		handled = append(handled, req.Content)
+		mu.Unlock()
+		return wxdev.NewTextMsg(req.ToUserName, req.FromUserName, "re:"+req.Content)
+	})
+	p := NewPushClient(c, "push-token")
+
+	send := func(from, content string) *PushReply {
+		t.Helper()
+		reply, err := p.Send(p.NewText(from, "gh_test", content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reply
+	}
+	// 协程阻塞在第一条消息, 第二条进入队列, 队列已满时第三条同步处理并被动回复
+	if reply := send("oBlock", "block"); !reply.IsSuccess() {
+		t.Fatalf("async reply = %s, want success", reply.Raw)
+	}
+	<-started
+	if reply := send("oQueued", "queued"); !reply.IsSuccess() {
+		t.Fatalf("queued reply = %s, want success", reply.Raw)
+	}
+	var text wxdev.WXTextMsgResponse
+	if err := send("oSync", "sync").Decode(&text); err != nil || text.Content.Text != "re:sync" {
+		t.Fatalf("sync reply = %+v, error = %v", text, err)
+	}
+
+	close(release)
+	c.Close()
+	if len(handled) != 3 {
+		t.Fatalf("handled = %v, want all messages handled after Close", handled)
+	}
+	texts := csTexts(t, srv)
+	if len(texts) != 2 || texts["oBlock"] != "re:block" || texts["oQueued"] != "re:queued" {
+		t.Errorf("custom messages = %v, want async replies only", texts)
+	}
+
+	// Close 之后退化为同步处理
+	if err := send("oClosed", "closed").Decode(&text); err != nil || text.Content.Text != "re:closed" {
+		t.Errorf("reply after Close = %+v, error = %v", text, err)
+	}
+}
+
+func TestAsyncHandlerPanic(t *testing.T) {
+	srv, c := newTestClient(t, wxdev.WithValidationToken("push-token"), wxdev.WithAsyncHandler(1, 1))
+	panicked := make(chan struct{})
+	c.MessageHandleFunc(func(req wxdev.WXMessageRequest) wxdev.WXMessageResponse {
+		if req.Content == "panic" {
+			defer close(panicked)
+			panic("handler failed")
+		}
+		return wxdev.NewTextMsg(req.ToUserName, req.FromUserName, "re:"+req.Content)
+	})
+	p := NewPushClient(c, "push-token")
+
+	if _, err := p.Send(p.NewText("oPanic", "gh_test", "panic")); err != nil {
+		t.Fatal(err)
+	}
+	<-panicked
+	reply, err := p.Send(p.NewText("oAfter", "gh_test", "after"))
+	if err != nil || !reply.IsSuccess() {
+		t.Fatalf("reply = %v, error = %v, want async success", reply, err)
+	}
+	c.Close()
+	if texts := csTexts(t, srv); len(texts) != 1 || texts["oAfter"] != "re:after" {
+		t.Errorf("custom messages = %v, want reply after recovered panic", texts)
+	}
+}
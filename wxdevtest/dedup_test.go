@@ -0,0 +1,97 @@
+package wxdevtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shengzhi/wxdev"
+)
+
+func TestLRUDedupStoreEviction(t *testing.T) {
+	s := wxdev.NewLRUDedupStore(2)
+	for _, step := range []struct {
+		key  string
+		want bool
+	}{
+		{"a", true},
+		{"b", true},
+		{"a", false}, // 重复的a成为最近使用
+		{"c", true},  // 淘汰最久未使用的b
+		{"a", false},
+		{"b", true},
+		{"c", true}, // b加入时淘汰了c
+	} {
+		if got := s.Add(step.key, time.Hour); got != step.want {
+			t.Fatalf("Add(%s) = %v, want %v", step.key, got, step.want)
+		}
+	}
+}
+
+func TestLRUDedupStoreTTL(t *testing.T) {
+	s := wxdev.NewLRUDedupStore(10)
+	if !s.Add("k", 20*time.Millisecond) {
+		t.Fatal("first Add returned false")
+	}
+	if s.Add("k", 20*time.Millisecond) {
+		t.Fatal("Add within ttl returned true")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !s.Add("k", time.Hour) {
+		t.Fatal("Add after ttl expired returned false")
+	}
+	if s.Add("k", time.Hour) {
+		t.Fatal("Add after renewal returned true")
+	}
+	s.Remove("k")
+	if !s.Add("k", time.Hour) {
+		t.Fatal("Add after Remove returned false")
+	}
+}
+
+func TestDedupKeyForEvents(t *testing.T) {
+	p := NewPushClient(nil, "")
+	subscribe := p.NewEvent(wxdev.EventTypeSubscribe, "oUser", "gh_test", "qrscene_1")
+	click := p.NewEvent(wxdev.EventTypeClick, "oUser", "gh_test", "menu_1")
+	click.CreateTime = subscribe.CreateTime
+	otherKey := click
+	otherKey.EventKey = "menu_2"
+	otherUser := click
+	otherUser.FromUserName = "oOther"
+
+	keys := map[string]string{}
+	for name, req := range map[string]wxdev.WXMessageRequest{
+		"subscribe": subscribe, "click": click, "other key": otherKey, "other user": otherUser,
+	} {
+		if req.MsgId != 0 {
+			t.Fatalf("%s event has MsgId %d", name, req.MsgId)
+		}
+		key := req.DedupKey()
+		if prev, has := keys[key]; has {
+			t.Errorf("%s and %s share dedup key %s", prev, name, key)
+		}
+		keys[key] = name
+	}
+}
+
+func TestDedupRetriedPush(t *testing.T) {
+	_, c := newTestClient(t, wxdev.WithValidationToken("push-token"), wxdev.WithDedup(wxdev.NewLRUDedupStore(100), time.Minute))
+	var handled []string
+	c.MessageHandleFunc(func(req wxdev.WXMessageRequest) wxdev.WXMessageResponse {
+		handled = append(handled, string(req.Event)+":"+req.EventKey+req.Content)
+		return nil
+	})
+	p := NewPushClient(c, "push-token")
+	click := p.NewEvent(wxdev.EventTypeClick, "oUser", "gh_test", "menu_1")
+	view := p.NewEvent(wxdev.EventTypeView, "oUser", "gh_test", "http://page")
+	view.CreateTime = click.CreateTime
+	text := p.NewText("oUser", "gh_test", "hi")
+	// 微信重试推送同一条消息
+	for _, req := range []wxdev.WXMessageRequest{click, click, view, text, text} {
+		if _, err := p.Send(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(handled) != 3 {
+		t.Errorf("handled = %v, want each message once", handled)
+	}
+}
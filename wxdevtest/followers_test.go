@@ -0,0 +1,109 @@
+package wxdevtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shengzhi/wxdev"
+)
+
+func setFollowers(srv *Server, n int) {
+	openids := make([]string, n)
+	for i := range openids {
+		openids[i] = fmt.Sprintf("oFollower%04d", i)
+	}
+	srv.SetFollowers(openids...)
+}
+
+// serialCheck 包装fn, 检测fn是否被并发调用
+func serialCheck(t *testing.T, fn func([]wxdev.WXUserInfo) error) func([]wxdev.WXUserInfo) error {
+	var running int32
+	return func(users []wxdev.WXUserInfo) error {
+		if atomic.AddInt32(&running, 1) > 1 {
+			t.Error("fn called concurrently")
+		}
+		defer atomic.AddInt32(&running, -1)
+		time.Sleep(time.Millisecond)
+		return fn(users)
+	}
+}
+
+func TestIterateFollowerInfo(t *testing.T) {
+	srv, c := newTestClient(t)
+	setFollowers(srv, 250)
+	const concurrency = 3
+	var inFlight, maxInFlight int32
+	srv.Handle("/cgi-bin/user/info/batchget", func(r Request) interface{} {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		var arg struct {
+			Users []struct {
+				OpenID string `json:"openid"`
+			} `json:"user_list"`
+		}
+		r.JSON(&arg)
+		users := make([]map[string]interface{}, 0, len(arg.Users))
+		for _, u := range arg.Users {
+			users = append(users, userInfo(u.OpenID))
+		}
+		return okReply("user_info_list", users)
+	})
+
+	seen := make(map[string]bool)
+	var batches int
+	err := c.IterateFollowerInfo(context.Background(), concurrency, serialCheck(t, func(users []wxdev.WXUserInfo) error {
+		if len(users) == 0 || len(users) > 100 {
+			t.Errorf("batch size = %d", len(users))
+		}
+		batches++
+		for _, u := range users {
+			seen[u.OpenID] = true
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batches != 3 || len(seen) != 250 {
+		t.Errorf("batches = %d, users = %d, want 3 batches of 250 users", batches, len(seen))
+	}
+	if max := atomic.LoadInt32(&maxInFlight); max > concurrency {
+		t.Errorf("%d batchget requests in flight, want at most %d", max, concurrency)
+	}
+}
+
+func TestIterateFollowerInfoError(t *testing.T) {
+	srv, c := newTestClient(t)
+	setFollowers(srv, 550)
+	srv.InjectError("/cgi-bin/user/info/batchget", wxdev.ErrCodeAPIDailyLimit, "api freq out of limit")
+
+	err := c.IterateFollowerInfo(context.Background(), 3, serialCheck(t, func([]wxdev.WXUserInfo) error { return nil }))
+	if !wxdev.IsRateLimited(err) {
+		t.Fatalf("error = %v, want injected errcode %d", err, wxdev.ErrCodeAPIDailyLimit)
+	}
+
+	// fn 返回的错误同样终止遍历, 且此后不再调用fn
+	errStop := errors.New("stop")
+	var calls int32
+	err = c.IterateFollowerInfo(context.Background(), 3, serialCheck(t, func([]wxdev.WXUserInfo) error {
+		atomic.AddInt32(&calls, 1)
+		return errStop
+	}))
+	if !errors.Is(err, errStop) {
+		t.Fatalf("error = %v, want %v", err, errStop)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("fn called %d times after returning an error", n)
+	}
+}
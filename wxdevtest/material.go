@@ -0,0 +1,160 @@
+// 模拟永久素材接口
+
+package wxdevtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"time"
+)
+
+// mockMaterial 模拟的永久素材
+type mockMaterial struct {
+	mediaID    string
+	t          string
+	name       string
+	data       []byte
+	title      string
+	intro      string
+	updateTime int64
+}
+
+// parseUpload 解析上传的文件及description字段
+func parseUpload(r Request) (name string, data []byte, desc string, ok bool) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return
+	}
+	form, err := multipart.NewReader(bytes.NewReader(r.Body), params["boundary"]).ReadForm(32 << 20)
+	if err != nil {
+		return
+	}
+	if files := form.File["media"]; len(files) > 0 {
+		if f, err := files[0].Open(); err == nil {
+			data, _ = ioutil.ReadAll(f)
+			f.Close()
+			name, ok = files[0].Filename, true
+		}
+	}
+	if v := form.Value["description"]; len(v) > 0 {
+		desc = v[0]
+	}
+	return
+}
+
+func (s *Server) registerMaterials() {
+	invalidMedia := errReply(40007, "invalid media_id")
+	mediaArg := func(r Request) string {
+		var arg struct {
+			MediaID string `json:"media_id"`
+		}
+		r.JSON(&arg)
+		return arg.MediaID
+	}
+
+	s.handlers["/cgi-bin/material/add_material"] = func(r Request) interface{} {
+		name, data, desc, ok := parseUpload(r)
+		if !ok {
+			return errReply(41005, "media data missing")
+		}
+		m := &mockMaterial{
+			mediaID: "material_" + randomString(), t: r.Query.Get("type"),
+			name: name, data: data, updateTime: time.Now().Unix(),
+		}
+		if m.t == "video" {
+			var d struct {
+				Title        string `json:"title"`
+				Introduction string `json:"introduction"`
+			}
+			json.Unmarshal([]byte(desc), &d)
+			m.title, m.intro = d.Title, d.Introduction
+		}
+		s.mu.Lock()
+		s.materials = append(s.materials, m)
+		s.mu.Unlock()
+		if m.t == "image" {
+			return okReply("media_id", m.mediaID, "url", "http://mmbiz.qpic.cn/wxdevtest/"+m.mediaID)
+		}
+		return okReply("media_id", m.mediaID)
+	}
+	s.handlers["/cgi-bin/media/uploadimg"] = func(r Request) interface{} {
+		if _, _, _, ok := parseUpload(r); !ok {
+			return errReply(41005, "media data missing")
+		}
+		return okReply("url", "http://mmbiz.qpic.cn/wxdevtest/"+randomString())
+	}
+	s.handlers["/cgi-bin/material/get_material"] = func(r Request) interface{} {
+		m := s.material(mediaArg(r))
+		switch {
+		case m == nil:
+			return invalidMedia
+		case m.t == "video":
+			return map[string]string{"title": m.title, "description": m.intro, "down_url": "http://wxdevtest/video/" + m.mediaID}
+		default:
+			return m.data
+		}
+	}
+	s.handlers["/cgi-bin/material/del_material"] = func(r Request) interface{} {
+		mediaid := mediaArg(r)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, m := range s.materials {
+			if m.mediaID == mediaid {
+				s.materials = append(s.materials[:i], s.materials[i+1:]...)
+				return okReply()
+			}
+		}
+		return invalidMedia
+	}
+	s.handlers["/cgi-bin/material/get_materialcount"] = func(Request) interface{} {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		count := map[string]int{"voice_count": 0, "video_count": 0, "image_count": 0, "news_count": 0}
+		for _, m := range s.materials {
+			count[m.t+"_count"]++
+		}
+		return count
+	}
+	s.handlers["/cgi-bin/material/batchget_material"] = func(r Request) interface{} {
+		var arg struct {
+			Type   string `json:"type"`
+			Offset int    `json:"offset"`
+			Count  int    `json:"count"`
+		}
+		r.JSON(&arg)
+		if arg.Count < 1 || arg.Count > 20 {
+			return errReply(40036, "invalid count")
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var matched []*mockMaterial
+		for _, m := range s.materials {
+			if m.t == arg.Type {
+				matched = append(matched, m)
+			}
+		}
+		items := []map[string]interface{}{}
+		for i := arg.Offset; i < len(matched) && len(items) < arg.Count; i++ {
+			m := matched[i]
+			items = append(items, map[string]interface{}{
+				"media_id": m.mediaID, "name": m.name, "update_time": m.updateTime,
+				"url": "http://mmbiz.qpic.cn/wxdevtest/" + m.mediaID,
+			})
+		}
+		return map[string]interface{}{"total_count": len(matched), "item_count": len(items), "item": items}
+	}
+}
+
+func (s *Server) material(mediaid string) *mockMaterial {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.materials {
+		if m.mediaID == mediaid {
+			return m
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package wxdevtest
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shengzhi/wxdev"
+)
+
+// newOAuthHandler 创建网页授权中间件保护的handler, 授权成功时输出openid, 失败时记录错误
+func newOAuthHandler(t *testing.T, options ...wxdev.OAuthOption) (http.Handler, *error) {
+	_, c := newTestClient(t)
+	var failed error
+	options = append(options, wxdev.WithOAuthSecret([]byte("oauth-secret")),
+		wxdev.WithOAuthErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+			failed = err
+			http.Error(w, err.Error(), http.StatusForbidden)
+		}))
+	m := c.NewOAuthMiddleware(options...)
+	return m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := wxdev.OAuthUserFromContext(r.Context())
+		w.Write([]byte(user.OpenID))
+	})), &failed
+}
+
+func serveOAuth(h http.Handler, uri string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", uri, nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func findCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// authorize 发起授权并模拟微信回调, 返回回调的响应
+func authorize(t *testing.T, h http.Handler, code string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := serveOAuth(h, "http://example.com/page?id=1")
+	stateCookie := findCookie(w, "wxoauth_state")
+	if w.Code != http.StatusFound || stateCookie == nil {
+		t.Fatalf("status = %d, state cookie = %v, want redirect to authorize", w.Code, stateCookie)
+	}
+	if !stateCookie.Secure {
+		t.Error("state cookie is not Secure behind https proxy")
+	}
+	loc, _ := url.Parse(w.Header().Get("Location"))
+	redirect, _ := url.Parse(loc.Query().Get("redirect_uri"))
+	if redirect.Scheme != "https" {
+		t.Errorf("redirect_uri = %s, want https", redirect)
+	}
+	q := redirect.Query()
+	q.Set("state", loc.Query().Get("state"))
+	if code != "" {
+		q.Set("code", code)
+	}
+	redirect.RawQuery = q.Encode()
+	return serveOAuth(h, redirect.String(), stateCookie)
+}
+
+func TestOAuthCallback(t *testing.T) {
+	h, failed := newOAuthHandler(t)
+	w := authorize(t, h, "oUser1")
+	userCookie := findCookie(w, "wxoauth")
+	if w.Code != http.StatusFound || userCookie == nil {
+		t.Fatalf("callback status = %d, error = %v", w.Code, *failed)
+	}
+	if loc := w.Header().Get("Location"); loc != "/page?id=1" {
+		t.Errorf("Location = %s, want code and state stripped", loc)
+	}
+	if !userCookie.Secure {
+		t.Error("session cookie is not Secure behind https proxy")
+	}
+	w = serveOAuth(h, "http://example.com/page?id=1", userCookie)
+	if w.Code != http.StatusOK || w.Body.String() != "oUser1" {
+		t.Errorf("status = %d, body = %s, want openid", w.Code, w.Body)
+	}
+}
+
+func TestOAuthStateMismatch(t *testing.T) {
+	h, failed := newOAuthHandler(t)
+	w := serveOAuth(h, "http://example.com/page?code=oUser1&state=forged",
+		&http.Cookie{Name: "wxoauth_state", Value: "issued"})
+	if w.Code != http.StatusForbidden || *failed == nil {
+		t.Fatalf("status = %d, error = %v, want state mismatch", w.Code, *failed)
+	}
+	if findCookie(w, "wxoauth") != nil {
+		t.Error("session cookie set on state mismatch")
+	}
+}
+
+func TestOAuthDeclined(t *testing.T) {
+	h, failed := newOAuthHandler(t, wxdev.WithOAuthScope(wxdev.OAuthScopeUserInfo))
+	w := authorize(t, h, "")
+	if w.Code != http.StatusForbidden || !errors.Is(*failed, wxdev.ErrOAuthDeclined) {
+		t.Fatalf("status = %d, error = %v, want ErrOAuthDeclined", w.Code, *failed)
+	}
+}
+
+func TestOAuthInvalidSessionCookie(t *testing.T) {
+	h, _ := newOAuthHandler(t)
+	expiredHandler, _ := newOAuthHandler(t, wxdev.WithOAuthCookie("wxoauth", -time.Minute))
+	expired := findCookie(authorize(t, expiredHandler, "oUser1"), "wxoauth")
+	valid := findCookie(authorize(t, h, "oUser1"), "wxoauth")
+	payload := valid.Value[:strings.LastIndex(valid.Value, ".")]
+
+	for name, value := range map[string]string{
+		"expired":   expired.Value,
+		"forged":    payload + ".0000",
+		"unsigned":  payload,
+		"tampered":  base64.RawURLEncoding.EncodeToString([]byte("oUser2||9999999999")) + valid.Value[len(payload):],
+		"malformed": "not-a-session",
+	} {
+		w := serveOAuth(h, "http://example.com/page", &http.Cookie{Name: "wxoauth", Value: value})
+		if w.Code != http.StatusFound || !strings.HasPrefix(w.Header().Get("Location"), "https://open.weixin.qq.com/") {
+			t.Errorf("%s cookie: status = %d, body = %s, want redirect to authorize", name, w.Code, w.Body)
+		}
+	}
+}
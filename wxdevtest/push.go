@@ -0,0 +1,255 @@
+// 模拟微信服务器推送消息, 用于测试消息处理逻辑
+
+package wxdevtest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/shengzhi/wxdev"
+	"github.com/shengzhi/wxdev/crypt"
+)
+
+// PushClient 模拟微信服务器向 WXClient.ServeHTTP 推送消息
+type PushClient struct {
+	handler http.Handler
+	token   string
+	appid   string
+	aesKey  []byte
+	msgID   int64
+}
+
+// NewPushClient 创建推送客户端, token 为公众号后台配置的令牌(Token)
+func NewPushClient(handler http.Handler, token string) *PushClient {
+	return &PushClient{handler: handler, token: token, msgID: time.Now().UnixNano()}
+}
+
+// WithAES 启用安全模式, 推送的消息将使用 encodingAESKey 加密
+func (p *PushClient) WithAES(appid, encodingAESKey string) *PushClient {
+	key, err := crypt.DecodeAESKey(encodingAESKey)
+	if err != nil {
+		panic(err)
+	}
+	p.appid, p.aesKey = appid, key
+	return p
+}
+
+// NewMessage 创建普通消息, from 为用户openid, to 为公众号原始ID
+func (p *PushClient) NewMessage(t wxdev.WXMessageType, from, to string) wxdev.WXMessageRequest {
+	return wxdev.WXMessageRequest{
+		ToUserName:   to,
+		FromUserName: from,
+		CreateTime:   time.Now().Unix(),
+		MsgType:      t,
+		MsgId:        atomic.AddInt64(&p.msgID, 1),
+	}
+}
+
+// NewEvent 创建事件推送
+func (p *PushClient) NewEvent(e wxdev.WXEventType, from, to, key string) wxdev.WXMessageRequest {
+	return wxdev.WXMessageRequest{
+		ToUserName:   to,
+		FromUserName: from,
+		CreateTime:   time.Now().Unix(),
+		MsgType:      wxdev.WXMsgTypeEvent,
+		Event:        e,
+		EventKey:     key,
+	}
+}
+
+// NewText 创建文本消息
+func (p *PushClient) NewText(from, to, content string) wxdev.WXMessageRequest {
+	msg := p.NewMessage(wxdev.WXMsgTypeText, from, to)
+	msg.Content = content
+	return msg
+}
+
+// NewImage 创建图片消息
+func (p *PushClient) NewImage(from, to, picURL, mediaid string) wxdev.WXMessageRequest {
+	msg := p.NewMessage(wxdev.WXMsgTypeImage, from, to)
+	msg.PicUrl, msg.MediaId = picURL, mediaid
+	return msg
+}
+
+// NewVoice 创建语音消息
+func (p *PushClient) NewVoice(from, to, mediaid, format, recognition string) wxdev.WXMessageRequest {
+	msg := p.NewMessage(wxdev.WXMsgTypeVoice, from, to)
+	msg.MediaId, msg.Format, msg.Recognition = mediaid, format, recognition
+	return msg
+}
+
+// NewVideo 创建视频消息, t 为 WXMsgTypeVideo 或 WXMsgTypeShortVideo
+func (p *PushClient) NewVideo(t wxdev.WXMessageType, from, to, mediaid, thumbMediaid string) wxdev.WXMessageRequest {
+	msg := p.NewMessage(t, from, to)
+	msg.MediaId, msg.ThumbMediaId = mediaid, thumbMediaid
+	return msg
+}
+
+// NewLocation 创建地理位置消息
+func (p *PushClient) NewLocation(from, to string, x, y float64, scale int, label string) wxdev.WXMessageRequest {
+	msg := p.NewMessage(wxdev.WXMsgTypeLocation, from, to)
+	msg.Location_X, msg.Location_Y, msg.Scale, msg.Label = x, y, scale, label
+	return msg
+}
+
+// NewLink 创建链接消息
+func (p *PushClient) NewLink(from, to, title, desc, uri string) wxdev.WXMessageRequest {
+	msg := p.NewMessage(wxdev.WXMsgTypeLink, from, to)
+	msg.Title, msg.Description, msg.Url = title, desc, uri
+	return msg
+}
+
+// Send 签名(及加密)消息并交由handler处理, 返回解析后的回复
+func (p *PushClient) Send(msg wxdev.WXMessageRequest) (*PushReply, error) {
+	plain, err := xml.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := randomString()[:10]
+	query := url.Values{}
+	query.Set("timestamp", timestamp)
+	query.Set("nonce", nonce)
+	query.Set("signature", crypt.SHA1([]byte(sortJoin(p.token, timestamp, nonce))))
+	query.Set("openid", msg.FromUserName)
+	body := plain
+	if len(p.aesKey) > 0 {
+		encrypt, err := crypt.EncryptMsg(p.aesKey, p.appid, plain)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("encrypt_type", "aes")
+		query.Set("msg_signature", crypt.MsgSignature(p.token, timestamp, nonce, encrypt))
+		body, err = xml.Marshal(struct {
+			XMLName    xml.Name `xml:"xml"`
+			ToUserName string
+			Encrypt    string
+		}{ToUserName: msg.ToUserName, Encrypt: encrypt})
+		if err != nil {
+			return nil, err
+		}
+	}
+	req := httptest.NewRequest("POST", "/?"+query.Encode(), bytes.NewReader(body))
+	req.Header.Set("Content-Type", "text/xml")
+	w := httptest.NewRecorder()
+	p.handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		return nil, fmt.Errorf("wxdevtest: unexpected status %d", w.Code)
+	}
+	return p.parseReply(w.Body.Bytes())
+}
+
+func (p *PushClient) parseReply(data []byte) (*PushReply, error) {
+	data = bytes.TrimSpace(data)
+	if len(p.aesKey) == 0 || len(data) == 0 || string(data) == "success" {
+		return &PushReply{Raw: data}, nil
+	}
+	var envelope struct {
+		Encrypt      string
+		MsgSignature string
+		TimeStamp    string
+		Nonce        string
+	}
+	if err := xml.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	if crypt.MsgSignature(p.token, envelope.TimeStamp, envelope.Nonce, envelope.Encrypt) != envelope.MsgSignature {
+		return nil, fmt.Errorf("wxdevtest: reply msg_signature mismatch")
+	}
+	plain, appid, err := crypt.DecryptMsg(p.aesKey, envelope.Encrypt)
+	if err != nil {
+		return nil, err
+	}
+	if appid != p.appid {
+		return nil, fmt.Errorf("wxdevtest: reply appid mismatch, expect:%s, actual:%s", p.appid, appid)
+	}
+	return &PushReply{Raw: plain}, nil
+}
+
+// PushReply 被动回复, 安全模式下为解密后的内容
+type PushReply struct {
+	Raw []byte
+}
+
+// IsSuccess 是否回复了 success 或空串(即不回复)
+func (r *PushReply) IsSuccess() bool {
+	return len(r.Raw) == 0 || string(r.Raw) == "success"
+}
+
+// MsgType 回复消息类型
+func (r *PushReply) MsgType() wxdev.WXMessageType {
+	var msg wxdev.WXMsgResponse
+	xml.Unmarshal(r.Raw, &msg)
+	return msg.MsgType
+}
+
+// Decode 将回复解析为v
+func (r *PushReply) Decode(v interface{}) error {
+	if r.IsSuccess() {
+		return fmt.Errorf("wxdevtest: no message replied")
+	}
+	return xml.Unmarshal(r.Raw, v)
+}
+
+// Text 解析为文本消息
+func (r *PushReply) Text() (msg wxdev.WXTextMsgResponse, err error) {
+	err = r.decodeAs(wxdev.WXMsgTypeText, &msg)
+	return
+}
+
+// Image 解析为图片消息
+func (r *PushReply) Image() (msg wxdev.WXImgMsgResponse, err error) {
+	err = r.decodeAs(wxdev.WXMsgTypeImage, &msg)
+	return
+}
+
+// Voice 解析为语音消息
+func (r *PushReply) Voice() (msg wxdev.WXVoiceMsgResponse, err error) {
+	err = r.decodeAs(wxdev.WXMsgTypeVoice, &msg)
+	return
+}
+
+// Video 解析为视频消息
+func (r *PushReply) Video() (msg wxdev.WXVideoMsgResponse, err error) {
+	err = r.decodeAs(wxdev.WXMsgTypeVideo, &msg)
+	return
+}
+
+// Music 解析为音乐消息
+func (r *PushReply) Music() (msg wxdev.WXMusicMsgResponse, err error) {
+	err = r.decodeAs(wxdev.WXMsgTypeMusic, &msg)
+	return
+}
+
+// Article 解析为图文消息
+func (r *PushReply) Article() (msg wxdev.WXArticleMsgResponse, err error) {
+	err = r.decodeAs(wxdev.WXMsgTypeNews, &msg)
+	return
+}
+
+// TransferCS 解析为转发客服消息
+func (r *PushReply) TransferCS() (msg wxdev.WXTransferCSResponse, err error) {
+	err = r.decodeAs(wxdev.WXMsgTypeTransferCS, &msg)
+	return
+}
+
+func (r *PushReply) decodeAs(t wxdev.WXMessageType, v interface{}) error {
+	if actual := r.MsgType(); actual != t {
+		return fmt.Errorf("wxdevtest: expect %s reply, actual:%q", t, actual)
+	}
+	return r.Decode(v)
+}
+
+func sortJoin(params ...string) string {
+	sort.Strings(params)
+	return strings.Join(params, "")
+}
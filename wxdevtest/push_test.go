@@ -0,0 +1,79 @@
+package wxdevtest
+
+import (
+	"testing"
+
+	"github.com/shengzhi/wxdev"
+)
+
+const testAESKey = "jWmYm7qr5nMoAUwZRjGtBxmz3KA1tkAj3ykkR6q2B2C"
+
+func TestPushClient(t *testing.T) {
+	for _, aes := range []bool{false, true} {
+		name := map[bool]string{false: "plaintext", true: "aes"}[aes]
+		t.Run(name, func(t *testing.T) {
+			options := []wxdev.OptionFunc{wxdev.WithValidationToken("push-token")}
+			if aes {
+				options = append(options, wxdev.WithEncodingAESKey(testAESKey))
+			}
+			srv, c := newTestClient(t, options...)
+			var got wxdev.WXMessageRequest
+			c.MessageHandleFunc(func(req wxdev.WXMessageRequest) wxdev.WXMessageResponse {
+				got = req
+				switch req.MsgType {
+				case wxdev.WXMsgTypeText:
+					return wxdev.NewTextMsg(req.ToUserName, req.FromUserName, "re:"+req.Content)
+				case wxdev.WXMsgTypeImage:
+					return wxdev.NewImgMsg(req.ToUserName, req.FromUserName, req.MediaId)
+				}
+				return nil
+			})
+			p := NewPushClient(c, "push-token")
+			if aes {
+				p.WithAES(srv.AppID, testAESKey)
+			}
+
+			reply, err := p.Send(p.NewText("oUser", "gh_test", "hello"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			text, err := reply.Text()
+			if err != nil || text.Content.Text != "re:hello" || text.ToUserName != "oUser" {
+				t.Errorf("text reply = %+v, error = %v", text, err)
+			}
+			if got.Content != "hello" || got.FromUserName != "oUser" || got.MsgId == 0 {
+				t.Errorf("handler received %+v", got)
+			}
+
+			if reply, err = p.Send(p.NewImage("oUser", "gh_test", "http://pic", "media-1")); err != nil {
+				t.Fatal(err)
+			}
+			if img, err := reply.Image(); err != nil || img.MediaID.Text != "media-1" {
+				t.Errorf("image reply = %+v, error = %v", img, err)
+			}
+
+			if reply, err = p.Send(p.NewEvent(wxdev.EventTypeSubscribe, "oUser", "gh_test", "qrscene_1")); err != nil {
+				t.Fatal(err)
+			}
+			if !reply.IsSuccess() || got.GetEventKey() != "1" {
+				t.Errorf("event reply = %s, received %+v", reply.Raw, got)
+			}
+
+			// 令牌错误的推送被拒绝
+			forged := NewPushClient(c, "wrong-token")
+			if aes {
+				forged.WithAES(srv.AppID, testAESKey)
+			}
+			if _, err := forged.Send(forged.NewText("oUser", "gh_test", "hello")); err == nil {
+				t.Error("push with wrong token accepted")
+			}
+			// 安全模式下拒绝明文推送
+			if aes {
+				plain := NewPushClient(c, "push-token")
+				if _, err := plain.Send(plain.NewText("oUser", "gh_test", "hello")); err == nil {
+					t.Error("plaintext push accepted in aes mode")
+				}
+			}
+		})
+	}
+}
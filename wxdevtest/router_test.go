@@ -0,0 +1,122 @@
+package wxdevtest
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/shengzhi/wxdev"
+)
+
+// reply 返回固定内容的处理器, 用于断言命中的路由
+func reply(name string) wxdev.WXMessageHandler {
+	return func(wxdev.WXMessageRequest) wxdev.WXMessageResponse { return name }
+}
+
+func TestMessageRouterPrecedence(t *testing.T) {
+	r := wxdev.NewMessageRouter().
+		OnClick("menu_1", reply("click key")).
+		OnEvent(wxdev.EventTypeClick, reply("click")).
+		OnScene("promo", reply("scene")).
+		OnEvent(wxdev.EventTypeSubscribe, reply("subscribe")).
+		OnKeyword("hello", reply("keyword")).
+		OnRegexp(regexp.MustCompile(`^h`), reply("regexp")).
+		OnText(reply("text")).
+		OnImage(reply("image")).
+		Fallback(reply("fallback"))
+	p := NewPushClient(nil, "")
+	event := func(e wxdev.WXEventType, key string) wxdev.WXMessageRequest {
+		return p.NewEvent(e, "oUser", "gh_test", key)
+	}
+	text := func(content string) wxdev.WXMessageRequest { return p.NewText("oUser", "gh_test", content) }
+
+	for _, tc := range []struct {
+		name string
+		req  wxdev.WXMessageRequest
+		want string
+	}{
+		{"event key before event", event(wxdev.EventTypeClick, "menu_1"), "click key"},
+		{"event without matching key", event(wxdev.EventTypeClick, "menu_2"), "click"},
+		{"subscribe scene without qrscene_ prefix", event(wxdev.EventTypeSubscribe, "qrscene_promo"), "scene"},
+		{"scan scene", event(wxdev.EventTypeScan, "promo"), "scene"},
+		{"subscribe without scene", event(wxdev.EventTypeSubscribe, ""), "subscribe"},
+		{"unrouted event", event(wxdev.EventTypeLocation, ""), "fallback"},
+		{"keyword before regexp", text(" hello "), "keyword"},
+		{"regexp before type", text("hi"), "regexp"},
+		{"text type", text("bye"), "text"},
+		{"message type", p.NewImage("oUser", "gh_test", "http://pic", "media"), "image"},
+		{"unrouted message", p.NewMessage(wxdev.WXMsgTypeVoice, "oUser", "gh_test"), "fallback"},
+	} {
+		if got := r.Handle(tc.req); got != tc.want {
+			t.Errorf("%s: routed to %v, want %s", tc.name, got, tc.want)
+		}
+	}
+
+	// 未设置Fallback时回复success
+	if got := wxdev.NewMessageRouter().Handle(text("hello")); got != (wxdev.WXMessageOKResponse{}) {
+		t.Errorf("default fallback = %#v, want WXMessageOKResponse", got)
+	}
+}
+
+func TestMessageRouterMiddleware(t *testing.T) {
+	var trace []string
+	mark := func(name string) wxdev.Middleware {
+		return func(next wxdev.WXMessageHandler) wxdev.WXMessageHandler {
+			return func(req wxdev.WXMessageRequest) wxdev.WXMessageResponse {
+				trace = append(trace, name+">")
+				resp := next(req)
+				trace = append(trace, "<"+name)
+				return resp
+			}
+		}
+	}
+	r := wxdev.NewMessageRouter().Use(mark("a"), mark("b")).Use(mark("c")).
+		OnText(func(wxdev.WXMessageRequest) wxdev.WXMessageResponse {
+			trace = append(trace, "handler")
+			return "ok"
+		})
+	p := NewPushClient(nil, "")
+	if got := r.Handle(p.NewText("oUser", "gh_test", "hi")); got != "ok" {
+		t.Fatalf("response = %v", got)
+	}
+	if got, want := strings.Join(trace, " "), "a> b> c> handler <c <b <a"; got != want {
+		t.Errorf("call order = %s, want %s", got, want)
+	}
+
+	// 中间件同样作用于Fallback
+	trace = nil
+	r.Handle(p.NewEvent(wxdev.EventTypeView, "oUser", "gh_test", "http://page"))
+	if got, want := strings.Join(trace, " "), "a> b> c> <c <b <a"; got != want {
+		t.Errorf("fallback call order = %s, want %s", got, want)
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	r := wxdev.NewMessageRouter().Use(wxdev.RecoveryMiddleware).
+		OnText(func(wxdev.WXMessageRequest) wxdev.WXMessageResponse { panic("handler failed") })
+	p := NewPushClient(nil, "")
+	if got := r.Handle(p.NewText("oUser", "gh_test", "hi")); got != (wxdev.WXMessageOKResponse{}) {
+		t.Errorf("response = %#v, want WXMessageOKResponse after panic", got)
+	}
+
+	// 通过ServeHTTP推送时同样回复success
+	_, c := newTestClient(t, wxdev.WithValidationToken("push-token"))
+	c.MessageHandleFunc(r.Handle)
+	p = NewPushClient(c, "push-token")
+	reply, err := p.Send(p.NewText("oUser", "gh_test", "hi"))
+	if err != nil || !reply.IsSuccess() {
+		t.Errorf("reply = %v, error = %v, want success", reply, err)
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	allow := func(openid string) bool { return openid == "oAdmin" }
+	r := wxdev.NewMessageRouter().Use(wxdev.AuthMiddleware(allow, reply("denied"))).OnText(reply("text"))
+	p := NewPushClient(nil, "")
+	if got := r.Handle(p.NewText("oAdmin", "gh_test", "hi")); got != "text" {
+		t.Errorf("allowed user routed to %v", got)
+	}
+	if got := r.Handle(p.NewText("oGuest", "gh_test", "hi")); got != "denied" {
+		t.Errorf("denied user routed to %v", got)
+	}
+}
@@ -0,0 +1,484 @@
+// 微信接口模拟服务, 用于单元测试
+
+package wxdevtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request 模拟服务收到的请求
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// JSON 将请求体解析为JSON
+func (r Request) JSON(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// HandlerFunc 接口模拟函数, 返回值将被编码为JSON; 返回 []byte 时原样输出
+type HandlerFunc func(r Request) interface{}
+
+type injectedError struct {
+	code int
+	msg  string
+}
+
+// Server 微信接口模拟服务, 同时模拟 tokenserver 的 /token 及 /jsapiticket 接口.
+//
+//	srv := wxdevtest.NewServer()
+//	defer srv.Close()
+//	c := wxdev.NewWXClient(srv.AppID, wxdev.WithBaseURL(srv.URL), wxdev.WithTokenServer(srv.URL))
+type Server struct {
+	*httptest.Server
+	AppID, AppSecret string
+
+	mu        sync.Mutex
+	token     string
+	served    string // tokenserver 缓存并下发的 access_token
+	ticket    string
+	handlers  map[string]HandlerFunc
+	followers []string
+	tags      map[int]*mockTag
+	blacklist map[string]bool
+	materials []*mockMaterial
+	nextTagID int
+	errors    map[string][]injectedError
+	requests  []Request
+}
+
+// NewServer 启动模拟服务
+func NewServer() *Server {
+	s := &Server{
+		AppID:     "wxdevtest",
+		AppSecret: "wxdevtest-secret",
+		ticket:    randomString(),
+		handlers:  make(map[string]HandlerFunc),
+		errors:    make(map[string][]injectedError),
+		tags:      make(map[int]*mockTag),
+		blacklist: make(map[string]bool),
+	}
+	s.token = randomString()
+	s.served = s.token
+	s.registerDefaults()
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Token 当前有效的 access_token
+func (s *Server) Token() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token
+}
+
+// ExpireToken 使当前 access_token 失效, 之后携带旧token的请求将返回 40001.
+// 与真实的 tokenserver 一样, /token 仍下发缓存的旧token, 直到客户端携带该token强制刷新
+func (s *Server) ExpireToken() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = randomString()
+}
+
+// SetFollowers 设置 /cgi-bin/user/get 返回的关注者openid
+func (s *Server) SetFollowers(openids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.followers = append([]string(nil), openids...)
+}
+
+// Handle 替换指定路径的模拟实现
+func (s *Server) Handle(path string, fn HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[path] = fn
+}
+
+// Respond 指定路径固定返回v
+func (s *Server) Respond(path string, v interface{}) {
+	s.Handle(path, func(Request) interface{} { return v })
+}
+
+// InjectError 指定路径的下一次调用返回错误码, 多次调用按顺序生效
+func (s *Server) InjectError(path string, code int, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[path] = append(s.errors[path], injectedError{code: code, msg: msg})
+}
+
+// Requests 返回已收到的请求, 指定path时仅返回该路径的请求
+func (s *Server) Requests(path ...string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var reqs []Request
+	for _, r := range s.requests {
+		if len(path) == 0 || r.Path == path[0] {
+			reqs = append(reqs, r)
+		}
+	}
+	return reqs
+}
+
+// LastRequest 返回指定路径的最后一次请求
+func (s *Server) LastRequest(path string) (Request, bool) {
+	reqs := s.Requests(path)
+	if len(reqs) == 0 {
+		return Request{}, false
+	}
+	return reqs[len(reqs)-1], true
+}
+
+// Reset 清空已记录的请求及注入的错误
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+	s.errors = make(map[string][]injectedError)
+}
+
+// ServeHTTP 分发请求
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	req := Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query(), Header: r.Header, Body: body}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	fn, has := s.handlers[req.Path]
+	var injected *injectedError
+	if errs := s.errors[req.Path]; len(errs) > 0 {
+		injected = &errs[0]
+		s.errors[req.Path] = errs[1:]
+	}
+	token := s.token
+	s.mu.Unlock()
+
+	switch {
+	case !has:
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, errReply(404, "wxdevtest: unknown api "+req.Path))
+	case injected != nil:
+		writeJSON(w, errReply(injected.code, injected.msg))
+	// 网页授权接口携带的是用户的access_token
+	case req.Query.Get("access_token") != "" && req.Query.Get("access_token") != token && !strings.HasPrefix(req.Path, "/sns/"):
+		writeJSON(w, errReply(40001, "invalid credential, access_token is invalid or not latest rid: wxdevtest"))
+	default:
+		switch v := fn(req).(type) {
+		case []byte:
+			w.Write(v)
+		default:
+			writeJSON(w, v)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+func errReply(code int, msg string) map[string]interface{} {
+	return map[string]interface{}{"errcode": code, "errmsg": msg}
+}
+
+func okReply(fields ...interface{}) map[string]interface{} {
+	m := errReply(0, "ok")
+	for i := 0; i+1 < len(fields); i += 2 {
+		m[fields[i].(string)] = fields[i+1]
+	}
+	return m
+}
+
+func (s *Server) registerDefaults() {
+	ok := func(Request) interface{} { return okReply() }
+	expired := func() string { return time.Now().Add(2 * time.Hour).Format("2006-01-02 15:04:05") }
+
+	// tokenserver 接口
+	s.handlers["/token"] = func(r Request) interface{} {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if r.Query.Get("refresh") == "1" && r.Query.Get("stale") == s.served {
+			// 缓存的token仍有效时强制生成新token
+			if s.served == s.token {
+				s.token = randomString()
+			}
+			s.served = s.token
+		}
+		return map[string]string{"token": s.served, "expired": expired()}
+	}
+	s.handlers["/jsapiticket"] = func(Request) interface{} {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return map[string]string{"ticket": s.ticket, "expired": expired()}
+	}
+
+	// access_token
+	token := func(Request) interface{} { return okReply("access_token", s.Token(), "expires_in", 7200) }
+	s.handlers["/cgi-bin/token"] = token
+	s.handlers["/cgi-bin/stable_token"] = func(r Request) interface{} {
+		var arg struct {
+			ForceRefresh bool `json:"force_refresh"`
+		}
+		r.JSON(&arg)
+		if arg.ForceRefresh {
+			s.ExpireToken()
+		}
+		return token(r)
+	}
+	s.handlers["/cgi-bin/ticket/getticket"] = func(Request) interface{} {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return okReply("ticket", s.ticket, "expires_in", 7200)
+	}
+
+	// 自定义菜单
+	s.handlers["/cgi-bin/menu/create"] = ok
+	s.handlers["/cgi-bin/menu/delete"] = ok
+	s.handlers["/cgi-bin/menu/addconditional"] = func(Request) interface{} { return okReply("menuid", "208379533") }
+	s.handlers["/cgi-bin/menu/delconditional"] = ok
+	s.handlers["/cgi-bin/menu/trymatch"] = func(Request) interface{} {
+		return okReply("button", []map[string]string{{"type": "view", "name": "wxdevtest", "url": "https://example.com"}})
+	}
+
+	// 用户管理
+	s.handlers["/cgi-bin/user/info"] = func(r Request) interface{} {
+		return userInfo(r.Query.Get("openid"))
+	}
+	s.handlers["/cgi-bin/user/get"] = func(r Request) interface{} {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		start := 0
+		if next := r.Query.Get("next_openid"); next != "" {
+			for i, openid := range s.followers {
+				if openid == next {
+					start = i + 1
+				}
+			}
+		}
+		end := start + 10000
+		if end > len(s.followers) {
+			end = len(s.followers)
+		}
+		page := s.followers[start:end]
+		next := ""
+		if len(page) > 0 {
+			next = page[len(page)-1]
+		}
+		return map[string]interface{}{
+			"total": len(s.followers), "count": len(page),
+			"data": map[string][]string{"openid": page}, "next_openid": next,
+		}
+	}
+	s.registerTags()
+	s.handlers["/cgi-bin/user/info/updateremark"] = ok
+	blacklist := func(black bool) HandlerFunc {
+		return func(r Request) interface{} {
+			var arg struct {
+				OpenIDs []string `json:"openid_list"`
+			}
+			r.JSON(&arg)
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			for _, openid := range arg.OpenIDs {
+				if black {
+					s.blacklist[openid] = true
+				} else {
+					delete(s.blacklist, openid)
+				}
+			}
+			return okReply()
+		}
+	}
+	s.handlers["/cgi-bin/tags/members/batchblacklist"] = blacklist(true)
+	s.handlers["/cgi-bin/tags/members/batchunblacklist"] = blacklist(false)
+	// 一次返回全部黑名单, begin_openid 非空时返回空页
+	s.handlers["/cgi-bin/tags/members/getblacklist"] = func(r Request) interface{} {
+		var arg struct {
+			BeginOpenID string `json:"begin_openid"`
+		}
+		r.JSON(&arg)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		openids := []string{}
+		if arg.BeginOpenID == "" {
+			for openid := range s.blacklist {
+				openids = append(openids, openid)
+			}
+			sort.Strings(openids)
+		}
+		next := ""
+		if len(openids) > 0 {
+			next = openids[len(openids)-1]
+		}
+		return map[string]interface{}{
+			"total": len(s.blacklist), "count": len(openids),
+			"data": map[string][]string{"openid": openids}, "next_openid": next,
+		}
+	}
+	s.handlers["/cgi-bin/user/info/batchget"] = func(r Request) interface{} {
+		var arg struct {
+			Users []struct {
+				OpenID string `json:"openid"`
+			} `json:"user_list"`
+		}
+		r.JSON(&arg)
+		users := make([]map[string]interface{}, 0, len(arg.Users))
+		for _, u := range arg.Users {
+			users = append(users, userInfo(u.OpenID))
+		}
+		return okReply("user_info_list", users)
+	}
+
+	// 网页授权, code 为 openid 时换取该用户的授权
+	snsToken := func(openid string) map[string]interface{} {
+		return okReply(
+			"access_token", "sns_"+openid, "expires_in", 7200, "refresh_token", "refresh_"+openid,
+			"openid", openid, "scope", "snsapi_userinfo", "unionid", strings.Replace(openid, "o", "u", 1),
+		)
+	}
+	s.handlers["/sns/oauth2/access_token"] = func(r Request) interface{} {
+		return snsToken(r.Query.Get("code"))
+	}
+	s.handlers["/sns/oauth2/refresh_token"] = func(r Request) interface{} {
+		return snsToken(strings.TrimPrefix(r.Query.Get("refresh_token"), "refresh_"))
+	}
+	s.handlers["/sns/auth"] = func(r Request) interface{} {
+		if r.Query.Get("access_token") != "sns_"+r.Query.Get("openid") {
+			return errReply(40003, "invalid openid")
+		}
+		return okReply()
+	}
+	s.handlers["/sns/userinfo"] = func(r Request) interface{} {
+		info := userInfo(r.Query.Get("openid"))
+		info["privilege"] = []string{}
+		return info
+	}
+
+	// 消息
+	var msgid int64 = 1000
+	s.handlers["/cgi-bin/message/template/send"] = func(Request) interface{} {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		msgid++
+		return okReply("msgid", msgid)
+	}
+	s.handlers["/cgi-bin/message/custom/send"] = ok
+	s.handlers["/cgi-bin/message/custom/typing"] = ok
+	s.handlers["/cgi-bin/message/subscribe/send"] = ok
+
+	// 客服管理
+	for _, path := range []string{
+		"/customservice/kfaccount/add", "/customservice/kfaccount/update", "/customservice/kfaccount/del",
+		"/customservice/kfaccount/inviteworker", "/customservice/kfaccount/uploadheadimg",
+		"/customservice/kfsession/create", "/customservice/kfsession/close",
+	} {
+		s.handlers[path] = ok
+	}
+	s.handlers["/cgi-bin/customservice/getkflist"] = func(Request) interface{} {
+		return okReply("kf_list", []map[string]interface{}{{"kf_account": "kf1@wxdevtest", "kf_nick": "wxdevtest", "kf_id": "1001"}})
+	}
+	s.handlers["/cgi-bin/customservice/getonlinekflist"] = func(Request) interface{} {
+		return okReply("kf_online_list", []map[string]interface{}{{"kf_account": "kf1@wxdevtest", "status": 1, "kf_id": "1001", "accepted_case": 1}})
+	}
+	s.handlers["/customservice/kfsession/getsession"] = func(Request) interface{} {
+		return okReply("kf_account", "kf1@wxdevtest", "createtime", time.Now().Unix())
+	}
+	s.handlers["/customservice/kfsession/getsessionlist"] = func(Request) interface{} {
+		return okReply("sessionlist", []map[string]interface{}{{"openid": "wxdevtest-openid", "createtime": time.Now().Unix()}})
+	}
+	s.handlers["/customservice/kfsession/getwaitcase"] = func(Request) interface{} {
+		return okReply("count", 0, "waitcaselist", []interface{}{})
+	}
+	s.handlers["/customservice/msgrecord/getmsglist"] = func(Request) interface{} {
+		return okReply("recordlist", []interface{}{}, "number", 0, "msgid", 1)
+	}
+
+	// 素材
+	s.handlers["/cgi-bin/media/upload"] = func(r Request) interface{} {
+		return okReply("type", r.Query.Get("type"), "media_id", "media_"+randomString(), "created_at", time.Now().Unix())
+	}
+	s.handlers["/cgi-bin/media/get"] = func(r Request) interface{} {
+		return []byte("wxdevtest media " + r.Query.Get("media_id"))
+	}
+	s.handlers["/cgi-bin/media/get/jssdk"] = s.handlers["/cgi-bin/media/get"]
+
+	s.registerMaterials()
+
+	// 二维码
+	s.handlers["/cgi-bin/qrcode/create"] = func(Request) interface{} {
+		return okReply("ticket", "qrcode_"+randomString(), "expire_seconds", 60, "url", "http://weixin.qq.com/q/wxdevtest")
+	}
+	s.handlers["/cgi-bin/showqrcode"] = func(r Request) interface{} {
+		return []byte("wxdevtest qrcode " + r.Query.Get("ticket"))
+	}
+
+	// 小程序
+	s.handlers["/sns/jscode2session"] = func(r Request) interface{} {
+		code := r.Query.Get("js_code")
+		return okReply("openid", "openid_"+code, "unionid", "unionid_"+code, "session_key", "c2Vzc2lvbl9rZXlfd3hkZXZ0ZXN0")
+	}
+	s.handlers["/wxa/business/getuserphonenumber"] = func(Request) interface{} {
+		return okReply("phone_info", map[string]interface{}{
+			"phoneNumber": "13800138000", "purePhoneNumber": "13800138000", "countryCode": "86",
+			"watermark": map[string]interface{}{"appid": s.AppID, "timestamp": time.Now().Unix()},
+		})
+	}
+	s.handlers["/wxa/generate_urllink"] = func(Request) interface{} {
+		return okReply("url_link", "https://wxaurl.cn/"+randomString()[:12])
+	}
+	s.handlers["/wxa/genwxashortlink"] = func(Request) interface{} {
+		return okReply("link", "#小程序://wxdevtest/"+randomString()[:6])
+	}
+	s.handlers["/wxa/query_urllink"] = func(Request) interface{} {
+		return okReply("url_link_info", map[string]interface{}{"appid": s.AppID, "env_version": "release"})
+	}
+	s.handlers["/wxa/generatescheme"] = func(Request) interface{} {
+		return okReply("openlink", "weixin://dl/business/?t="+randomString()[:12])
+	}
+	s.handlers["/wxa/generatenfcscheme"] = s.handlers["/wxa/generatescheme"]
+	s.handlers["/wxa/queryscheme"] = func(Request) interface{} {
+		return okReply("scheme_info", map[string]interface{}{"appid": s.AppID, "env_version": "release"})
+	}
+	s.handlers["/tcb/sendsmsv2"] = func(r Request) interface{} {
+		var arg struct {
+			Phones []string `json:"phone_number_list"`
+		}
+		r.JSON(&arg)
+		status := make([]map[string]string, 0, len(arg.Phones))
+		for i, phone := range arg.Phones {
+			status = append(status, map[string]string{
+				"serial_no": fmt.Sprintf("wxdevtest-%d", i), "phone_number": phone,
+				"code": "Ok", "message": "send success", "iso_code": "CN",
+			})
+		}
+		return okReply("send_status_list", status)
+	}
+}
+
+func userInfo(openid string) map[string]interface{} {
+	return okReply(
+		"subscribe", 1, "openid", openid, "nickname", "wxdevtest", "sex", 0,
+		"language", "zh_CN", "subscribe_time", time.Now().Unix(),
+		"unionid", strings.Replace(openid, "o", "u", 1), "tagid_list", []int{},
+	)
+}
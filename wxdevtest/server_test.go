@@ -0,0 +1,109 @@
+package wxdevtest
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shengzhi/wxdev"
+	"github.com/shengzhi/wxdev/tokenserver"
+)
+
+func newTestClient(t *testing.T, options ...wxdev.OptionFunc) (*Server, *wxdev.WXClient) {
+	srv := NewServer()
+	t.Cleanup(srv.Close)
+	options = append([]wxdev.OptionFunc{wxdev.WithBaseURL(srv.URL), wxdev.WithTokenServer(srv.URL)}, options...)
+	return srv, wxdev.NewWXClient(srv.AppID, options...)
+}
+
+// assertRefreshed 检查客户端携带失效的token向 tokenserver 强制刷新, 并以新token重试了接口
+func assertRefreshed(t *testing.T, srv *Server, path, stale string) {
+	t.Helper()
+	var refreshed bool
+	for _, r := range srv.Requests("/token") {
+		if r.Query.Get("refresh") == "1" && r.Query.Get("stale") == stale {
+			refreshed = true
+		}
+	}
+	if !refreshed {
+		t.Errorf("no refresh request to tokenserver for stale token %s", stale)
+	}
+	reqs := srv.Requests(path)
+	if len(reqs) < 2 {
+		t.Fatalf("%s called %d times, want a retry", path, len(reqs))
+	}
+	if got := reqs[len(reqs)-2].Query.Get("access_token"); got != stale {
+		t.Errorf("first call used token %s, want stale token %s", got, stale)
+	}
+	if got := reqs[len(reqs)-1].Query.Get("access_token"); got != srv.Token() {
+		t.Errorf("retry used token %s, want current token %s", got, srv.Token())
+	}
+}
+
+func TestExpiredTokenRetry(t *testing.T) {
+	srv, c := newTestClient(t)
+	tag, err := c.CreateTag("vip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := srv.Token()
+	srv.ExpireToken()
+
+	tags, err := c.GetTags()
+	if err != nil {
+		t.Fatalf("GetTags after ExpireToken: %v", err)
+	}
+	if len(tags) == 0 || tags[len(tags)-1].ID != tag.ID {
+		t.Errorf("tags = %+v, want created tag %+v", tags, tag)
+	}
+	assertRefreshed(t, srv, "/cgi-bin/tags/get", stale)
+}
+
+func TestExpiredTokenDownloadRetry(t *testing.T) {
+	srv, c := newTestClient(t)
+	content := []byte("\x89PNG wxdevtest")
+	m, err := c.AddMaterial(wxdev.StuffTypeImage, "a.png", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := srv.Token()
+	srv.ExpireToken()
+
+	obj, err := c.GetMaterial(m.MediaID)
+	if err != nil {
+		t.Fatalf("GetMaterial after ExpireToken: %v", err)
+	}
+	data, _ := ioutil.ReadAll(obj.Data)
+	if !bytes.Equal(data, content) {
+		t.Errorf("material = %q, want %q", data, content)
+	}
+	assertRefreshed(t, srv, "/cgi-bin/material/get_material", stale)
+}
+
+// TestTokenServerError 微信拒绝发放access_token时, 客户端应返回微信的错误码而不是以空token调用接口
+func TestTokenServerError(t *testing.T) {
+	srv := NewServer()
+	t.Cleanup(srv.Close)
+	srv.Handle("/cgi-bin/token", func(Request) interface{} {
+		return map[string]interface{}{"errcode": 40164, "errmsg": "invalid ip 1.2.3.4, not in whitelist rid: wxdevtest"}
+	})
+	ts := tokenserver.NewServer(tokenserver.WithBaseURL(srv.URL))
+	ts.Register(srv.AppID, srv.AppSecret)
+	tsrv := httptest.NewServer(ts.Handler())
+	t.Cleanup(tsrv.Close)
+	c := wxdev.NewWXClient(srv.AppID, wxdev.WithBaseURL(srv.URL), wxdev.WithTokenServer(tsrv.URL))
+
+	_, err := c.GetUserInfo("openid-1")
+	if code := wxdev.ErrCode(err); code != 40164 {
+		t.Fatalf("GetUserInfo error = %v, want errcode 40164", err)
+	}
+	var apiErr *wxdev.APIError
+	if !errors.As(err, &apiErr) || apiErr.RID != "wxdevtest" {
+		t.Errorf("error = %#v, want APIError with rid", err)
+	}
+	if reqs := srv.Requests("/cgi-bin/user/info"); len(reqs) != 0 {
+		t.Errorf("user/info called %d times without access_token", len(reqs))
+	}
+}
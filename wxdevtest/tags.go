@@ -0,0 +1,124 @@
+// 模拟用户标签接口
+
+package wxdevtest
+
+import "sort"
+
+// mockTag 模拟的用户标签
+type mockTag struct {
+	name    string
+	members map[string]bool
+}
+
+func (s *Server) registerTags() {
+	type tagArg struct {
+		Tag struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		} `json:"tag"`
+		TagID      int      `json:"tagid"`
+		OpenIDs    []string `json:"openid_list"`
+		OpenID     string   `json:"openid"`
+		NextOpenID string   `json:"next_openid"`
+	}
+	// withTag 解析参数并在持有锁时调用fn
+	withTag := func(fn func(arg tagArg) interface{}) HandlerFunc {
+		return func(r Request) interface{} {
+			var arg tagArg
+			r.JSON(&arg)
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return fn(arg)
+		}
+	}
+	notFound := errReply(45159, "invalid tag id")
+
+	s.handlers["/cgi-bin/tags/create"] = withTag(func(arg tagArg) interface{} {
+		s.nextTagID++
+		if s.nextTagID < 100 {
+			s.nextTagID = 100 // 0, 1, 2 为系统保留标签
+		}
+		s.tags[s.nextTagID] = &mockTag{name: arg.Tag.Name, members: make(map[string]bool)}
+		return okReply("tag", map[string]interface{}{"id": s.nextTagID, "name": arg.Tag.Name})
+	})
+	s.handlers["/cgi-bin/tags/get"] = withTag(func(tagArg) interface{} {
+		tags := make([]map[string]interface{}, 0, len(s.tags))
+		for _, id := range s.tagIDs() {
+			tag := s.tags[id]
+			tags = append(tags, map[string]interface{}{"id": id, "name": tag.name, "count": len(tag.members)})
+		}
+		return okReply("tags", tags)
+	})
+	s.handlers["/cgi-bin/tags/update"] = withTag(func(arg tagArg) interface{} {
+		tag, has := s.tags[arg.Tag.ID]
+		if !has {
+			return notFound
+		}
+		tag.name = arg.Tag.Name
+		return okReply()
+	})
+	s.handlers["/cgi-bin/tags/delete"] = withTag(func(arg tagArg) interface{} {
+		if _, has := s.tags[arg.Tag.ID]; !has {
+			return notFound
+		}
+		delete(s.tags, arg.Tag.ID)
+		return okReply()
+	})
+	s.handlers["/cgi-bin/tags/members/batchtagging"] = withTag(func(arg tagArg) interface{} {
+		tag, has := s.tags[arg.TagID]
+		if !has {
+			return notFound
+		}
+		for _, openid := range arg.OpenIDs {
+			tag.members[openid] = true
+		}
+		return okReply()
+	})
+	s.handlers["/cgi-bin/tags/members/batchuntagging"] = withTag(func(arg tagArg) interface{} {
+		tag, has := s.tags[arg.TagID]
+		if !has {
+			return notFound
+		}
+		for _, openid := range arg.OpenIDs {
+			delete(tag.members, openid)
+		}
+		return okReply()
+	})
+	s.handlers["/cgi-bin/tags/getidlist"] = withTag(func(arg tagArg) interface{} {
+		ids := []int{}
+		for _, id := range s.tagIDs() {
+			if s.tags[id].members[arg.OpenID] {
+				ids = append(ids, id)
+			}
+		}
+		return okReply("tagid_list", ids)
+	})
+	// 一次返回所有粉丝, next_openid 非空时返回空页
+	s.handlers["/cgi-bin/user/tag/get"] = withTag(func(arg tagArg) interface{} {
+		tag, has := s.tags[arg.TagID]
+		if !has {
+			return notFound
+		}
+		openids := []string{}
+		if arg.NextOpenID == "" {
+			for openid := range tag.members {
+				openids = append(openids, openid)
+			}
+			sort.Strings(openids)
+		}
+		next := ""
+		if len(openids) > 0 {
+			next = openids[len(openids)-1]
+		}
+		return map[string]interface{}{"count": len(openids), "data": map[string][]string{"openid": openids}, "next_openid": next}
+	})
+}
+
+func (s *Server) tagIDs() []int {
+	ids := make([]int, 0, len(s.tags))
+	for id := range s.tags {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,82 @@
+// Package wxerr 微信接口返回的错误, 由公众号、小程序及Token server共用
+package wxerr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 常见全局返回码
+const (
+	ErrCodeInvalidCredential  = 40001 // access_token无效或不是最新的
+	ErrCodeInvalidAccessToken = 40014 // 不合法的access_token
+	ErrCodeAccessTokenExpired = 42001 // access_token超时
+	ErrCodeUserRefused        = 43101 // 用户拒绝接受消息
+	ErrCodeAPIDailyLimit      = 45009 // 接口调用超过日限制
+	ErrCodeAPIMinuteLimit     = 45011 // 接口调用频率超过限制
+)
+
+// APIError 微信接口返回的错误
+type APIError struct {
+	Code int
+	Msg  string
+	// RID 微信返回的请求ID, 可用于在公众平台排查问题
+	RID string
+}
+
+// NewAPIError 根据errcode/errmsg创建错误, 自动提取errmsg中的rid
+func NewAPIError(code int, msg string) *APIError {
+	e := &APIError{Code: code, Msg: msg}
+	if idx := strings.LastIndex(msg, "rid:"); idx >= 0 {
+		e.RID = strings.TrimSpace(msg[idx+len("rid:"):])
+	}
+	return e
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("WXDev: errcode:%d, errmsg:%s", e.Code, e.Msg)
+}
+
+// ErrCode 返回err中的微信错误码, 非APIError时返回0
+func ErrCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return 0
+}
+
+func hasErrCode(err error, codes ...int) bool {
+	code := ErrCode(err)
+	for _, c := range codes {
+		if code == c {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTokenExpiredCode 错误码是否表示access_token无效或已过期
+func IsTokenExpiredCode(code int) bool {
+	switch code {
+	case ErrCodeInvalidCredential, ErrCodeInvalidAccessToken, ErrCodeAccessTokenExpired:
+		return true
+	}
+	return false
+}
+
+// IsTokenExpired access_token是否无效或已过期
+func IsTokenExpired(err error) bool {
+	return IsTokenExpiredCode(ErrCode(err))
+}
+
+// IsRateLimited 是否触发接口调用频率或次数限制
+func IsRateLimited(err error) bool {
+	return hasErrCode(err, ErrCodeAPIDailyLimit, ErrCodeAPIMinuteLimit)
+}
+
+// IsUserRefused 用户是否拒绝接受消息
+func IsUserRefused(err error) bool {
+	return hasErrCode(err, ErrCodeUserRefused)
+}